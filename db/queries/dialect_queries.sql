@@ -0,0 +1,12 @@
+-- name: Now
+-- description: Returns the current time
+-- dialect: postgres
+SELECT now()
+
+-- name: Now
+-- dialect: sqlite
+SELECT datetime('now')
+
+-- name: Version
+-- dialect: postgres
+SELECT version()
@@ -0,0 +1,5 @@
+-- fragment: audit_columns
+created_at, updated_at
+
+-- fragment: tenant_filter
+tenant_id = :tenant_id
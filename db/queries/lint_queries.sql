@@ -0,0 +1,16 @@
+-- name: FindAll
+-- description: Selects every row
+SELECT * FROM test
+
+-- name: DeleteAll
+-- description: Deletes every row
+DELETE FROM test
+
+-- name: UpdateMixed
+-- params: cola bigint, colb bigint
+UPDATE test SET ColA = $1 WHERE ColA = :cola
+
+-- name: Clean
+-- description: Counts rows, ignoring text that looks like SQL
+-- params: cola bigint
+SELECT count(*), 'SELECT * FROM t' AS s, $$DELETE FROM t$$ AS d /* UPDATE t */ FROM test WHERE ColA = :cola FOR UPDATE
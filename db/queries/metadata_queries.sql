@@ -0,0 +1,11 @@
+-- name: InsertTest
+-- description: Inserts a row into the test table
+-- params: cola bigint
+-- timeout: 500ms
+-- tags: test, write
+INSERT INTO test (ColA) VALUES (:cola)
+
+-- name: FindWrongColumns
+-- columns: id
+-- readonly: true
+SELECT ColA FROM test
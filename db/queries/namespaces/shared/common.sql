@@ -0,0 +1,4 @@
+-- namespace: common
+
+-- name: Now
+SELECT now()
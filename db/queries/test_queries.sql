@@ -0,0 +1,11 @@
+-- Queries used by the annotated SQL loader tests.
+
+-- name: FindTest
+-- description: Finds a row in the test table
+-- description: by its primary key.
+SELECT ColA
+FROM test
+WHERE ColA = :cola;
+
+-- name: InsertTest
+INSERT INTO test (ColA) VALUES (:cola)
@@ -0,0 +1,12 @@
+-- name: FindTest
+-- description: Available from the first migration
+-- minSchemaVersion: 1
+SELECT ColA FROM test WHERE ColA = :cola
+
+-- name: FindTestB
+-- description: Requires a later migration adding ColB
+-- minSchemaVersion: 20190601120000
+SELECT ColA, ColB FROM test WHERE ColA = :cola
+
+-- name: Now
+SELECT now()
@@ -15,12 +15,13 @@
 package dbx
 
 import (
+	"context"
 	"database/sql"
 
 	"github.com/jmoiron/sqlx"
 )
 
-// DBContext represents a protocol for providing data from an underlying database. The lack of exposure of transaction semantics here is deliberate as transactions can be adapted to this protocol. In other words, a DB object or Tx object can conform to this interface, provided that sqlx is used for named query support.
+// DBContext represents a protocol for providing data from an underlying database. The lack of exposure of transaction semantics here is deliberate as transactions can be adapted to this protocol. In other words, a DB object or Tx object can conform to this interface, provided that sqlx is used for named query support. A *sqlx.DB conforms directly, while a *sqlx.Tx is adapted using NewTxContext.
 type DBContext interface {
 	// NamedExec executes a query that contains named query parameters, returning result metadata or an error.
 	NamedExec(query string, arg interface{}) (sql.Result, error)
@@ -28,4 +29,20 @@ type DBContext interface {
 	NamedQuery(query string, arg interface{}) (*sqlx.Rows, error)
 	// PrepareNamed prepares a query with named parameters. Returns a prepared statement or an error.
 	PrepareNamed(query string) (*sqlx.NamedStmt, error)
+	// NamedExecContext executes a query that contains named query parameters, returning result metadata or an error. Cancelling the context, or reaching its deadline, cancels the query.
+	NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error)
+	// NamedQueryContext executes a query that contains named parameters. Returns rows returned by the database or an error. Cancelling the context, or reaching its deadline, cancels the query.
+	NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sqlx.Rows, error)
+	// PrepareNamedContext prepares a query with named parameters. Returns a prepared statement or an error. The context is used for preparation only, not for execution of the statement.
+	PrepareNamedContext(ctx context.Context, query string) (*sqlx.NamedStmt, error)
+}
+
+// NamedGet executes a query that contains named parameters, scanning the first returned row into dest, which is either a pointer to a struct or a pointer to a scannable value. Returns sql.ErrNoRows if the query returns no rows. Any error encountered while iterating the rows is returned, and the rows are always closed. Works with any DBContext, including a DBTxContext.
+func NamedGet(ctx context.Context, db DBContext, dest interface{}, query string, arg interface{}) error {
+	return getRow(ctx, db, dest, QueryValue{Query: query}, arg)
+}
+
+// NamedSelect executes a query that contains named parameters, scanning each returned row into dest, which must be a pointer to a slice of structs or scannable values. Any error encountered while iterating the rows is returned, and the rows are always closed. Works with any DBContext, including a DBTxContext.
+func NamedSelect(ctx context.Context, db DBContext, dest interface{}, query string, arg interface{}) error {
+	return selectRows(ctx, db, dest, QueryValue{Query: query}, arg)
 }
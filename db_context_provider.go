@@ -14,6 +14,11 @@
 
 package dbx
 
+import (
+	"context"
+	"database/sql"
+)
+
 // DBContextProvider provides database connections suitable for reading or writing.
 type DBContextProvider interface {
 	// GetTxContext returns a transaction context, or an error
@@ -21,3 +26,17 @@ type DBContextProvider interface {
 	// GetContext returns a database context
 	GetContext() (DBContext, error)
 }
+
+// TxContextProvider is a DBContextProvider able to begin transactions with a context and transaction options. RunInTx and RunInTxWithRetry use BeginTxContext when the provider implements it.
+type TxContextProvider interface {
+	DBContextProvider
+	// BeginTxContext begins a transaction, returning a transaction context, or an error. The transaction is rolled back if the context is cancelled before the transaction is committed. opts may be nil to use the default isolation level and access mode.
+	BeginTxContext(ctx context.Context, opts *sql.TxOptions) (DBTxContext, error)
+}
+
+// PgTxContextProvider is a TxContextProvider able to begin Postgres transactions using settings that have no equivalent in sql.TxOptions. RunInPgTx and RunInTxWithRetry use GetPgTxContext to begin transactions with PgTxOptions.
+type PgTxContextProvider interface {
+	TxContextProvider
+	// GetPgTxContext begins a transaction using opts, applying the Postgres specific settings before any other statement is executed, returning a transaction context, or an error.
+	GetPgTxContext(ctx context.Context, opts PgTxOptions) (DBTxContext, error)
+}
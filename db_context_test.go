@@ -0,0 +1,77 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamedGetAndSelectErrors(t *testing.T) {
+	// given
+	db := &recordingContext{err: errors.New("failed")}
+	var rows []int64
+	var row int64
+
+	// when
+	destErr := NamedSelect(context.Background(), db, rows, "SELECT 1", nil)
+	selectErr := NamedSelect(context.Background(), db, &rows, "SELECT 1", nil)
+	getErr := NamedGet(context.Background(), db, &row, "SELECT 1", nil)
+
+	// then
+	assert.EqualError(t, destErr, "destination must be a non-nil pointer to a slice")
+	assert.EqualError(t, selectErr, "failed")
+	assert.EqualError(t, getErr, "failed")
+	assert.Equal(t, []string{"SELECT 1", "SELECT 1"}, db.statements)
+}
+
+func TestNamedGetAndSelect(t *testing.T) {
+	// given
+	db := setupTestDB(t, GenerateSchemaName("namedgetschema"))
+	ctx := context.Background()
+	tx, err := db.BeginTxx(ctx, nil)
+	assert.NoError(t, err)
+	txContext := NewTxContext(tx)
+	defer txContext.Rollback()
+	type row struct {
+		ColA int64 `db:"cola"`
+	}
+	_, err = txContext.NamedExecContext(ctx, "INSERT INTO test (ColA) VALUES (:cola)", map[string]interface{}{"cola": 200})
+	assert.NoError(t, err)
+
+	for _, dbContext := range []DBContext{db, txContext} {
+		// when
+		var found row
+		getErr := NamedGet(ctx, dbContext, &found, "SELECT ColA FROM test WHERE ColA = :cola", map[string]interface{}{"cola": 100})
+		noRowsErr := NamedGet(ctx, dbContext, &found, "SELECT ColA FROM test WHERE ColA = :cola", map[string]interface{}{"cola": 300})
+		var rows []row
+		selectErr := NamedSelect(ctx, dbContext, &rows, "SELECT ColA FROM test WHERE ColA >= :cola", map[string]interface{}{"cola": 100})
+		var values []*int64
+		valuesErr := NamedSelect(ctx, dbContext, &values, "SELECT ColA FROM test ORDER BY ColA", nil)
+
+		// then
+		assert.NoError(t, getErr)
+		assert.Equal(t, int64(100), found.ColA)
+		assert.Equal(t, sql.ErrNoRows, noRowsErr)
+		assert.NoError(t, selectErr)
+		assert.NoError(t, valuesErr)
+		assert.Equal(t, len(rows), len(values))
+		assert.Equal(t, int64(100), *values[0])
+	}
+}
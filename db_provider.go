@@ -0,0 +1,98 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var _ PgTxContextProvider = (*DBProvider)(nil)
+
+// DBProvider is a PgTxContextProvider backed by a single *sqlx.DB, serving both reads and transactions from the same connection pool.
+type DBProvider struct {
+	db *sqlx.DB
+}
+
+// PgTxOptions holds the options of a Postgres transaction, including the settings that have no equivalent in sql.TxOptions.
+type PgTxOptions struct {
+	// TxOptions sets the isolation level and access mode, and may be nil to use the defaults.
+	TxOptions *sql.TxOptions
+	// Deferrable makes a serializable, read only transaction wait until it is able to run without the possibility of a serialization failure.
+	Deferrable bool
+	// Snapshot, if set, is the identifier of a snapshot exported with ExportSnapshot by another transaction. The transaction sees the same data as the exporting transaction, and must use the repeatable read or serializable isolation level.
+	Snapshot string
+}
+
+// NewDBProvider returns a PgTxContextProvider backed by db.
+func NewDBProvider(db *sqlx.DB) *DBProvider {
+	return &DBProvider{db: db}
+}
+
+// GetContext returns the database.
+func (p *DBProvider) GetContext() (DBContext, error) {
+	return p.db, nil
+}
+
+// GetTxContext begins a transaction using the default isolation level and access mode.
+func (p *DBProvider) GetTxContext() (DBTxContext, error) {
+	return p.BeginTxContext(context.Background(), nil)
+}
+
+// BeginTxContext begins a transaction using opts, which may request any isolation level supported by the driver, or a read only transaction. opts may be nil to use the defaults.
+func (p *DBProvider) BeginTxContext(ctx context.Context, opts *sql.TxOptions) (DBTxContext, error) {
+	tx, err := p.db.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewTxContext(tx), nil
+}
+
+// GetPgTxContext begins a transaction using opts, applying the Postgres specific settings with SET TRANSACTION before any other statement is executed. The transaction is rolled back if a setting is rejected.
+func (p *DBProvider) GetPgTxContext(ctx context.Context, opts PgTxOptions) (DBTxContext, error) {
+	tx, err := p.db.BeginTxx(ctx, opts.TxOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range opts.statements() {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return NewTxContext(tx), nil
+}
+
+// statements returns the SET TRANSACTION statements applying the Postgres specific settings. The snapshot is set first, as Postgres requires.
+func (o PgTxOptions) statements() []string {
+	var stmts []string
+	if o.Snapshot != "" {
+		stmts = append(stmts, "SET TRANSACTION SNAPSHOT "+pq.QuoteLiteral(o.Snapshot))
+	}
+	if o.Deferrable {
+		stmts = append(stmts, "SET TRANSACTION DEFERRABLE")
+	}
+	return stmts
+}
+
+// ExportSnapshot exports the snapshot of a repeatable read or serializable transaction, returning an identifier that other transactions import using PgTxOptions.Snapshot. The snapshot remains importable until the exporting transaction ends.
+func ExportSnapshot(ctx context.Context, tx DBTxContext) (string, error) {
+	var snapshot string
+	err := NamedGet(ctx, tx, &snapshot, "SELECT pg_export_snapshot()", nil)
+	return snapshot, err
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPgTxOptionsStatements(t *testing.T) {
+	// given
+	opts := PgTxOptions{Snapshot: "00000003-0000001B-1", Deferrable: true}
+
+	// when
+	stmts := opts.statements()
+
+	// then
+	assert.Equal(t, []string{"SET TRANSACTION SNAPSHOT '00000003-0000001B-1'", "SET TRANSACTION DEFERRABLE"}, stmts)
+	assert.Empty(t, PgTxOptions{}.statements())
+}
+
+func TestDBProvider(t *testing.T) {
+	// given
+	db := setupTestDB(t, GenerateSchemaName("providerschema"))
+	provider := NewDBProvider(db)
+	ctx := context.Background()
+	repeatableRead := &sql.TxOptions{Isolation: sql.LevelRepeatableRead}
+
+	// when
+	exporter, exporterErr := provider.BeginTxContext(ctx, repeatableRead)
+	snapshot, snapshotErr := ExportSnapshot(ctx, exporter)
+	_, insertErr := db.NamedExecContext(ctx, "INSERT INTO test (ColA) VALUES (:cola)", map[string]interface{}{"cola": 200})
+	importer, importerErr := provider.GetPgTxContext(ctx, PgTxOptions{TxOptions: repeatableRead, Snapshot: snapshot})
+	var count int64
+	countErr := NamedGet(ctx, importer, &count, "SELECT count(*) FROM test", nil)
+	deferrable, deferrableErr := provider.GetPgTxContext(ctx, PgTxOptions{TxOptions: &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true}, Deferrable: true})
+	var setting string
+	settingErr := NamedGet(ctx, deferrable, &setting, "SHOW transaction_deferrable", nil)
+	_, invalidErr := provider.GetPgTxContext(ctx, PgTxOptions{TxOptions: repeatableRead, Snapshot: "invalid"})
+
+	// then
+	assert.NoError(t, exporterErr)
+	assert.NoError(t, snapshotErr)
+	assert.NotEmpty(t, snapshot)
+	assert.NoError(t, insertErr)
+	assert.NoError(t, importerErr)
+	assert.NoError(t, countErr)
+	assert.Equal(t, int64(1), count)
+	assert.NoError(t, deferrableErr)
+	assert.NoError(t, settingErr)
+	assert.Equal(t, "on", setting)
+	assert.Error(t, invalidErr)
+	assert.NoError(t, importer.Rollback())
+	assert.NoError(t, deferrable.Rollback())
+	assert.NoError(t, exporter.Rollback())
+}
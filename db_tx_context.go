@@ -22,3 +22,10 @@ type DBTxContext interface {
 	// Rollback rollbacks a transaction or returns an error
 	Rollback() error
 }
+
+// NestedTxContext is a transaction context able to begin transactions nested within it.
+type NestedTxContext interface {
+	DBTxContext
+	// Begin begins a nested transaction within this transaction, returning a transaction context or an error. Commit and Rollback of the nested transaction only affect the work done within it, and a nested transaction must end before the transaction containing it is committed.
+	Begin() (NestedTxContext, error)
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command dbx-gen generates a Go file containing a constant for every named query found in a set of query files, and optionally a typed function wrapping each query. It is intended to be run with go generate:
+//
+//	//go:generate go run github.com/dakiva/dbx/dbx-gen -package queries -out queries_gen.go db/queries/*.json
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/dakiva/dbx"
+	"github.com/dakiva/dbx/internal/queryfiles"
+)
+
+func main() {
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "Package name of the generated file. Defaults to the package invoking go generate.")
+	out := flag.String("out", "", "Path of the generated file. The generated code is written to stdout if not specified.")
+	prefix := flag.String("prefix", "Query", "Prefix prepended to each generated query name constant.")
+	funcs := flag.Bool("funcs", false, "Generates a typed function, and parameter struct, for every query.")
+	queriesVar := flag.String("var", "Queries", "Name of the generated QueryMap variable used by generated functions.")
+	strict := flag.Bool("strict", true, "Rejects query names that are defined more than once.")
+	dialect := flag.String("dialect", "", "Dialect used to select query variants.")
+	flag.Parse()
+
+	if *pkg == "" {
+		log.Fatalln("A package name is required.")
+	}
+	if flag.NArg() == 0 {
+		log.Fatalln("At least one query file is required.")
+	}
+	files, err := queryfiles.Expand(flag.Args())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	queryMap, err := dbx.LoadNamedQueriesWithOptions(dbx.QueryLoadOptions{Strict: *strict, Dialect: *dialect}, files...)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	g := &generator{
+		Package:    *pkg,
+		Prefix:     *prefix,
+		Funcs:      *funcs,
+		QueriesVar: *queriesVar,
+	}
+	src, err := g.generate(queryMap)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if *out == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := ioutil.WriteFile(*out, src, 0644); err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/dakiva/dbx"
+)
+
+// initialisms are identifier parts that are upper cased in their entirety, following Go naming conventions.
+var initialisms = map[string]bool{
+	"API":  true,
+	"HTTP": true,
+	"ID":   true,
+	"JSON": true,
+	"SQL":  true,
+	"URL":  true,
+	"UUID": true,
+}
+
+// goTypes maps declared SQL parameter types, normalized by sqlType, to the Go types of the generated parameter struct fields. Parameters of any other type are generated as interface{}.
+var goTypes = map[string]string{
+	"bigint":                      "int64",
+	"int8":                        "int64",
+	"bigserial":                   "int64",
+	"integer":                     "int32",
+	"int":                         "int32",
+	"int4":                        "int32",
+	"serial":                      "int32",
+	"smallint":                    "int16",
+	"int2":                        "int16",
+	"double precision":            "float64",
+	"float8":                      "float64",
+	"real":                        "float32",
+	"float4":                      "float32",
+	"text":                        "string",
+	"varchar":                     "string",
+	"character varying":           "string",
+	"char":                        "string",
+	"character":                   "string",
+	"citext":                      "string",
+	"uuid":                        "string",
+	"boolean":                     "bool",
+	"bool":                        "bool",
+	"bytea":                       "[]byte",
+	"date":                        "time.Time",
+	"timestamp":                   "time.Time",
+	"timestamptz":                 "time.Time",
+	"timestamp without time zone": "time.Time",
+	"timestamp with time zone":    "time.Time",
+}
+
+// generator renders the Go source for a set of named queries.
+type generator struct {
+	Package    string
+	Prefix     string
+	Funcs      bool
+	QueriesVar string
+}
+
+// queryData describes a single query to the template.
+type queryData struct {
+	Name        string
+	Const       string
+	Func        string
+	Params      string
+	Description string
+	Fields      []fieldData
+	// Exec is true for statements that return no rows
+	Exec bool
+	// Struct is false if the query uses nested parameters, which cannot be represented by a flat struct
+	Struct bool
+}
+
+// fieldData describes a single field of a parameter struct.
+type fieldData struct {
+	Name string
+	Type string
+	Tag  string
+}
+
+// generate returns the formatted Go source for the query map. Returns an error if two queries map to the same Go identifier, a query maps to the name of the query map variable, two parameters of a query map to the same struct field, or a query contains malformed named parameters.
+func (g *generator) generate(queryMap dbx.QueryMap) ([]byte, error) {
+	names := make([]string, 0, len(queryMap))
+	for name := range queryMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	identifiers := make(map[string]string)
+	claim := func(identifier, name string) error {
+		if g.Funcs && identifier == g.QueriesVar {
+			return fmt.Errorf("query %v generates the identifier %v, which is reserved for the query map variable", name, identifier)
+		}
+		if other, exists := identifiers[identifier]; exists {
+			return fmt.Errorf("queries %v and %v both generate the identifier %v", other, name, identifier)
+		}
+		identifiers[identifier] = name
+		return nil
+	}
+	queries := make([]queryData, 0, len(names))
+	for _, name := range names {
+		value := queryMap[name]
+		data := queryData{
+			Name:        name,
+			Const:       g.Prefix + identifier(name),
+			Func:        identifier(name),
+			Params:      identifier(name) + "Params",
+			Description: strings.Join(strings.Fields(value.Description), " "),
+			Exec:        isExecStatement(value.Query),
+			Struct:      true,
+		}
+		if err := claim(data.Const, name); err != nil {
+			return nil, err
+		}
+		if g.Funcs {
+			params, err := dbx.NamedParameters(value.Query)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", name, err)
+			}
+			declared := make(map[string]string)
+			for _, param := range value.Params {
+				declared[param.Name] = param.Type
+			}
+			fields := make(map[string]string)
+			for _, param := range params {
+				if strings.Contains(param, ".") {
+					data.Struct = false
+				}
+				field := fieldData{Name: identifier(param), Type: goType(declared[param]), Tag: param}
+				if other, exists := fields[field.Name]; exists && data.Struct {
+					return nil, fmt.Errorf("%v: parameters %v and %v both generate the field %v", name, other, param, field.Name)
+				}
+				fields[field.Name] = param
+				data.Fields = append(data.Fields, field)
+			}
+			if err := claim(data.Func, name); err != nil {
+				return nil, err
+			}
+			if data.Struct && len(data.Fields) > 0 {
+				if err := claim(data.Params, name); err != nil {
+					return nil, err
+				}
+			}
+		}
+		queries = append(queries, data)
+	}
+	var buf bytes.Buffer
+	err := fileTemplate.Execute(&buf, map[string]interface{}{
+		"Generator": g,
+		"Queries":   queries,
+		"UsesExec":  usesExec(queries),
+		"UsesQuery": usesQuery(queries),
+		"UsesTime":  usesTime(queries),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+func usesExec(queries []queryData) bool {
+	for _, query := range queries {
+		if query.Exec {
+			return true
+		}
+	}
+	return false
+}
+
+func usesQuery(queries []queryData) bool {
+	for _, query := range queries {
+		if !query.Exec {
+			return true
+		}
+	}
+	return false
+}
+
+// usesTime reports whether any generated parameter struct has a time.Time field.
+func usesTime(queries []queryData) bool {
+	for _, query := range queries {
+		if !query.Struct {
+			continue
+		}
+		for _, field := range query.Fields {
+			if field.Type == "time.Time" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// goType returns the Go type of a parameter with the given declared SQL type, or interface{} if the type is unknown or undeclared. The type is matched case insensitively, ignoring any length or precision modifier, so that varchar(255) maps to string.
+func goType(sqlType string) string {
+	if idx := strings.Index(sqlType, "("); idx >= 0 {
+		if end := strings.Index(sqlType[idx:], ")"); end >= 0 {
+			sqlType = sqlType[:idx] + sqlType[idx+end+1:]
+		}
+	}
+	if goType, ok := goTypes[strings.Join(strings.Fields(strings.ToLower(sqlType)), " ")]; ok {
+		return goType
+	}
+	return "interface{}"
+}
+
+// identifier converts a query or parameter name into an exported Go identifier. The name is split on any character that is not a letter or digit, and each part is capitalized, so that "users.find_by_id" becomes UsersFindByID.
+func identifier(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, part := range parts {
+		if initialisms[strings.ToUpper(part)] {
+			b.WriteString(strings.ToUpper(part))
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	result := b.String()
+	if result == "" || unicode.IsDigit([]rune(result)[0]) {
+		result = "Q" + result
+	}
+	return result
+}
+
+// isExecStatement reports whether a query is an INSERT, UPDATE or DELETE statement that does not return rows.
+func isExecStatement(query string) bool {
+	fields := strings.Fields(strings.ToUpper(stripComments(query)))
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[0] {
+	case "INSERT", "UPDATE", "DELETE":
+		for _, field := range fields {
+			if field == "RETURNING" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// stripComments removes -- line comments from a query.
+func stripComments(query string) string {
+	lines := strings.Split(query, "\n")
+	for i, line := range lines {
+		if idx := strings.Index(line, "--"); idx >= 0 {
+			lines[i] = line[:idx]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+var fileTemplate = template.Must(template.New("file").Parse(`// Code generated by dbx-gen. DO NOT EDIT.
+
+package {{.Generator.Package}}
+{{if .Generator.Funcs}}
+import (
+	"context"
+{{- if .UsesExec}}
+	"database/sql"
+{{- end}}
+{{- if .UsesTime}}
+	"time"
+{{- end}}
+
+	"github.com/dakiva/dbx"
+{{- if .UsesQuery}}
+	"github.com/jmoiron/sqlx"
+{{- end}}
+)
+{{end}}
+// Named query identifiers, for use with dbx.QueryMap.Q.
+const (
+{{- range .Queries}}
+	// {{.Const}} identifies the {{.Name}} query.{{if .Description}} {{.Description}}{{end}}
+	{{.Const}} = {{printf "%q" .Name}}
+{{- end}}
+)
+{{if .Generator.Funcs}}
+// {{.Generator.QueriesVar}} holds the named queries executed by the generated functions. It must be set, typically using dbx.MustLoadNamedQueries, before any generated function is called.
+var {{.Generator.QueriesVar}} dbx.QueryMap
+{{range .Queries}}
+{{- if and .Struct .Fields}}
+// {{.Params}} holds the named parameters of the {{.Name}} query.
+type {{.Params}} struct {
+{{- range .Fields}}
+	{{.Name}} {{.Type}} ` + "`" + `db:"{{.Tag}}"` + "`" + `
+{{- end}}
+}
+{{end}}
+// {{.Func}} executes the {{.Name}} query.{{if .Description}} {{.Description}}{{end}}
+func {{.Func}}(ctx context.Context, db dbx.DBContext{{if .Fields}}, arg {{if .Struct}}{{.Params}}{{else}}interface{}{{end}}{{end}}) ({{if .Exec}}sql.Result{{else}}*sqlx.Rows{{end}}, error) {
+	return db.{{if .Exec}}NamedExecContext{{else}}NamedQueryContext{{end}}(ctx, {{$.Generator.QueriesVar}}.Q({{.Const}}), {{if .Fields}}arg{{else}}map[string]interface{}{}{{end}})
+}
+{{end}}
+{{- end}}
+`))
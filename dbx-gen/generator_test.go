@@ -0,0 +1,199 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/dakiva/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateConstants(t *testing.T) {
+	// given
+	g := &generator{Package: "queries", Prefix: "Query"}
+	queryMap := dbx.QueryMap{
+		"FindUser": {Query: "SELECT id FROM users WHERE id = :id", Description: "Finds a user"},
+	}
+
+	// when
+	src, err := g.generate(queryMap)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, `// Code generated by dbx-gen. DO NOT EDIT.
+
+package queries
+
+// Named query identifiers, for use with dbx.QueryMap.Q.
+const (
+	// QueryFindUser identifies the FindUser query. Finds a user
+	QueryFindUser = "FindUser"
+)
+`, string(src))
+}
+
+func TestGenerateFuncs(t *testing.T) {
+	// given
+	g := &generator{Package: "queries", Prefix: "Query", Funcs: true, QueriesVar: "Queries"}
+	queryMap := dbx.QueryMap{
+		"users.find_by_id": {Query: "SELECT id, name::text FROM users WHERE id = :user_id"},
+		"DeleteUsers":      {Query: "-- removes everything\nDELETE FROM users"},
+		"InsertUser":       {Query: "INSERT INTO users (name) VALUES (:name) RETURNING id"},
+		"FindByAccount":    {Query: "SELECT id FROM users WHERE account = :account.id"},
+	}
+
+	// when
+	src, err := g.generate(queryMap)
+
+	// then
+	assert.NoError(t, err)
+	code := string(src)
+	assert.Contains(t, code, "type UsersFindByIDParams struct {\n\tUserID interface{} `db:\"user_id\"`\n}")
+	assert.Contains(t, code, "func UsersFindByID(ctx context.Context, db dbx.DBContext, arg UsersFindByIDParams) (*sqlx.Rows, error) {\n\treturn db.NamedQueryContext(ctx, Queries.Q(QueryUsersFindByID), arg)\n}")
+	assert.Contains(t, code, "func DeleteUsers(ctx context.Context, db dbx.DBContext) (sql.Result, error) {\n\treturn db.NamedExecContext(ctx, Queries.Q(QueryDeleteUsers), map[string]interface{}{})\n}")
+	assert.Contains(t, code, "func InsertUser(ctx context.Context, db dbx.DBContext, arg InsertUserParams) (*sqlx.Rows, error)")
+	assert.Contains(t, code, "func FindByAccount(ctx context.Context, db dbx.DBContext, arg interface{}) (*sqlx.Rows, error)")
+	assert.NotContains(t, code, "FindByAccountParams")
+}
+
+func TestGenerateTypedParams(t *testing.T) {
+	// given
+	g := &generator{Package: "queries", Prefix: "Query", Funcs: true, QueriesVar: "Queries"}
+	queryMap := dbx.QueryMap{
+		"UpdateUser": {
+			Query: "UPDATE users SET name = :name, active = :active, seen = :seen, data = :data WHERE id = :id",
+			Params: []dbx.QueryParam{
+				{Name: "id", Type: "BIGINT"},
+				{Name: "name", Type: "varchar(255)"},
+				{Name: "active", Type: "boolean"},
+				{Name: "seen", Type: "timestamp with time zone"},
+				{Name: "data", Type: "jsonb"},
+			},
+		},
+		"FindUser": {Query: "SELECT id FROM users WHERE id = :id", Params: []dbx.QueryParam{{Name: "id", Type: "integer"}}},
+	}
+
+	// when
+	src, err := g.generate(queryMap)
+
+	// then
+	assert.NoError(t, err)
+	code := string(src)
+	assert.Contains(t, code, "import (\n\t\"context\"\n\t\"database/sql\"\n\t\"time\"\n\n\t\"github.com/dakiva/dbx\"")
+	assert.Contains(t, code, "type UpdateUserParams struct {\n\tName   string      `db:\"name\"`\n\tActive bool        `db:\"active\"`\n\tSeen   time.Time   `db:\"seen\"`\n\tData   interface{} `db:\"data\"`\n\tID     int64       `db:\"id\"`\n}")
+	assert.Contains(t, code, "type FindUserParams struct {\n\tID int32 `db:\"id\"`\n}")
+}
+
+func TestGeneratedCodeCompiles(t *testing.T) {
+	// given
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	g := &generator{Package: "queries", Prefix: "Query", Funcs: true, QueriesVar: "Queries"}
+	queryMap := dbx.QueryMap{
+		"FindUser":      {Query: "SELECT id FROM users WHERE id = :id AND created > :since", Params: []dbx.QueryParam{{Name: "id", Type: "bigint"}, {Name: "since", Type: "timestamp"}}},
+		"InsertUser":    {Query: "INSERT INTO users (name, data) VALUES (:name, :data)", Params: []dbx.QueryParam{{Name: "name", Type: "text"}}},
+		"FindByAccount": {Query: "SELECT id FROM users WHERE account = :account.id"},
+		"CountUsers":    {Query: "SELECT count(*) FROM users"},
+	}
+	src, err := g.generate(queryMap)
+	assert.NoError(t, err)
+	dir, err := os.MkdirTemp(".", "_generated")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "queries_gen.go"), src, 0644))
+
+	// when
+	out, err := exec.Command(goCmd, "vet", "./"+dir).CombinedOutput()
+
+	// then
+	assert.NoError(t, err, string(out))
+}
+
+func TestGoType(t *testing.T) {
+	cases := map[string]string{
+		"bigint":                      "int64",
+		"VARCHAR(64)":                 "string",
+		"character  varying(10)":      "string",
+		"timestamp without time zone": "time.Time",
+		"numeric(10, 2)":              "interface{}",
+		"integer[]":                   "interface{}",
+		"":                            "interface{}",
+	}
+	for sqlType, expected := range cases {
+		assert.Equal(t, expected, goType(sqlType), sqlType)
+	}
+}
+
+func TestGenerateIdentifierCollision(t *testing.T) {
+	// given
+	g := &generator{Package: "queries", Prefix: "Query"}
+	queryMap := dbx.QueryMap{
+		"find_user": {Query: "SELECT 1"},
+		"FindUser":  {Query: "SELECT 2"},
+	}
+
+	// when
+	_, err := g.generate(queryMap)
+
+	// then
+	assert.EqualError(t, err, "queries FindUser and find_user both generate the identifier QueryFindUser")
+}
+
+func TestGenerateReservedQueriesVar(t *testing.T) {
+	// given
+	g := &generator{Package: "queries", Funcs: true, QueriesVar: "Queries"}
+	queryMap := dbx.QueryMap{
+		"Queries": {Query: "SELECT 1"},
+	}
+
+	// when
+	_, err := g.generate(queryMap)
+
+	// then
+	assert.EqualError(t, err, "query Queries generates the identifier Queries, which is reserved for the query map variable")
+}
+
+func TestGenerateFieldCollision(t *testing.T) {
+	// given
+	g := &generator{Package: "queries", Prefix: "Query", Funcs: true, QueriesVar: "Queries"}
+	queryMap := dbx.QueryMap{
+		"FindUser": {Query: "SELECT id FROM users WHERE id = :user_id OR id = :userID"},
+	}
+
+	// when
+	_, err := g.generate(queryMap)
+
+	// then
+	assert.EqualError(t, err, "FindUser: parameters user_id and userID both generate the field UserID")
+}
+
+func TestIdentifier(t *testing.T) {
+	cases := map[string]string{
+		"FindUser":       "FindUser",
+		"find_user_id":   "FindUserID",
+		"users.FindByID": "UsersFindByID",
+		"get-api-key":    "GetAPIKey",
+		"2fa":            "Q2fa",
+	}
+	for name, expected := range cases {
+		assert.Equal(t, expected, identifier(name))
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command dbx-vet reports references to undefined named queries, and named queries that are never referenced, using the queryvet analyzer:
+//
+//	dbx-vet -queries 'db/queries/*.json' ./...
+//
+// The analyzer may also be run by go vet:
+//
+//	go vet -vettool=$(which dbx-vet) -queries 'db/queries/*.json' ./...
+package main
+
+import (
+	"github.com/dakiva/dbx/queryvet"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(queryvet.Analyzer)
+}
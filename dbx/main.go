@@ -0,0 +1,108 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command dbx provides tooling for dbx query files. The lint-queries command checks every query for common SQL mistakes, reporting each issue with the file and line of the offending statement or parameter:
+//
+//	dbx lint-queries [-format text|json] [-disable rule,...] db/queries/*.json
+//
+// The command exits with status 1 if any issue is found.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dakiva/dbx"
+	"github.com/dakiva/dbx/internal/queryfiles"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	switch os.Args[1] {
+	case "lint-queries":
+		os.Exit(lintQueries(os.Args[2:], os.Stdout, os.Stderr))
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dbx lint-queries [flags] files...")
+}
+
+// lintQueries runs the lint-queries command, returning the exit status.
+func lintQueries(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("lint-queries", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "text", "Output format, either text or json.")
+	disable := flags.String("disable", "", "Comma separated list of rules to disable: "+strings.Join(dbx.LintRules, ", ")+".")
+	dialect := flags.String("dialect", "", "Dialect used to select query variants.")
+	namespaceFromFileName := flags.Bool("namespace-from-file-name", false, "Derives a namespace from the file name of query files that do not declare one.")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "At least one query file is required.")
+		return 2
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(stderr, "Unknown format: %v\n", *format)
+		return 2
+	}
+	files, err := queryfiles.Expand(flags.Args())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	queryMap, err := dbx.LoadNamedQueriesWithOptions(dbx.QueryLoadOptions{Dialect: *dialect, NamespaceFromFileName: *namespaceFromFileName}, files...)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	var opts dbx.LintOptions
+	for _, rule := range strings.Split(*disable, ",") {
+		if rule = strings.TrimSpace(rule); rule != "" {
+			opts.Disabled = append(opts.Disabled, rule)
+		}
+	}
+	issues, err := queryMap.Lint(opts)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if *format == "json" {
+		if issues == nil {
+			issues = []dbx.LintIssue{}
+		}
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(issues)
+	} else {
+		for _, issue := range issues {
+			fmt.Fprintln(stdout, issue)
+		}
+	}
+	if len(issues) > 0 {
+		return 1
+	}
+	return 0
+}
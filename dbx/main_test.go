@@ -0,0 +1,78 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/dakiva/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintQueriesText(t *testing.T) {
+	// given
+	var stdout, stderr bytes.Buffer
+
+	// when
+	status := lintQueries([]string{"-disable", "empty-description, unused-param,mixed-placeholders", "../db/queries/lint_*.sql"}, &stdout, &stderr)
+
+	// then
+	assert.Equal(t, 1, status)
+	assert.Equal(t, "../db/queries/lint_queries.sql:3: query FindAll: SELECT * selects every column, list the columns instead (select-star)\n../db/queries/lint_queries.sql:7: query DeleteAll: DELETE without a WHERE clause (unfiltered-write)\n", stdout.String())
+	assert.Empty(t, stderr.String())
+}
+
+func TestLintQueriesJSON(t *testing.T) {
+	// given
+	var stdout, stderr bytes.Buffer
+
+	// when
+	status := lintQueries([]string{"-format", "json", "../db/queries/lint_queries.sql"}, &stdout, &stderr)
+
+	// then
+	assert.Equal(t, 1, status)
+	var issues []dbx.LintIssue
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &issues))
+	assert.Len(t, issues, 5)
+	assert.Equal(t, dbx.LintIssue{Rule: "select-star", Query: "FindAll", File: "../db/queries/lint_queries.sql", Line: 3, Message: "SELECT * selects every column, list the columns instead"}, issues[0])
+}
+
+func TestLintQueriesClean(t *testing.T) {
+	// given
+	var stdout, stderr bytes.Buffer
+
+	// when
+	status := lintQueries([]string{"-format", "json", "-disable", "empty-description", "../db/queries/test_queries.yaml"}, &stdout, &stderr)
+
+	// then
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "[]\n", stdout.String())
+}
+
+func TestLintQueriesUsageErrors(t *testing.T) {
+	cases := map[string][]string{
+		"At least one query file is required.\n":        {},
+		"Unknown format: xml\n":                         {"-format", "xml", "q.sql"},
+		"unknown lint rule: nope\n":                     {"-disable", "nope", "../db/queries/lint_queries.sql"},
+		"open missing.sql: no such file or directory\n": {"missing.sql"},
+	}
+	for expected, args := range cases {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, lintQueries(args, &stdout, &stderr))
+		assert.Equal(t, expected, stderr.String())
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package queryfiles holds helpers shared by the dbx commands for locating query files.
+package queryfiles
+
+import "path/filepath"
+
+// Expand expands glob patterns in the file arguments of a command, as go generate, and some shells, do not. An argument matching no files is kept as is, so that loading the queries reports the missing file.
+func Expand(args []string) ([]string, error) {
+	files := make([]string, 0, len(args))
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			// let the loader report the missing file
+			matches = []string{arg}
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
@@ -0,0 +1,32 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queryfiles
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpand(t *testing.T) {
+	// when
+	files, err := Expand([]string{"../../db/queries/namespaces/*.json", "missing.json"})
+	_, patternErr := Expand([]string{"[.json"})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"../../db/queries/namespaces/users.json", "missing.json"}, files)
+	assert.Error(t, patternErr)
+}
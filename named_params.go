@@ -0,0 +1,63 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// NamedParameters returns the distinct named parameters referenced by a query, in order of first appearance. Parameters are recognized using the same rules sqlx applies when compiling a named query: a colon followed by letters, digits, underscores or periods starts a parameter, "::" is an escaped colon, as used by Postgres casts, and ":=" is left untouched. Returns an error if sqlx would reject the query, such as when a colon appears within a parameter name.
+func NamedParameters(query string) ([]string, error) {
+	runes := []rune(query)
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(name []rune) {
+		// a lone colon is not a parameter
+		if len(name) > 0 && !seen[string(name)] {
+			seen[string(name)] = true
+			names = append(names, string(name))
+		}
+	}
+	inName := false
+	var name []rune
+	for i, r := range runes {
+		switch {
+		case r == ':' && inName && i > 0 && runes[i-1] == ':':
+			// the second colon of a "::" escape sequence
+			inName = false
+		case r == ':' && inName:
+			return nil, fmt.Errorf("unexpected `:` while reading named param at %d", i)
+		case r == ':':
+			inName = true
+			name = name[:0]
+		case inName && r == '=':
+			inName = false
+		case inName && isNamedParameterRune(r):
+			name = append(name, r)
+		case inName:
+			inName = false
+			add(name)
+		}
+	}
+	if inName {
+		add(name)
+	}
+	return names, nil
+}
+
+func isNamedParameterRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.'
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamedParameters(t *testing.T) {
+	cases := map[string][]string{
+		"SELECT 1": {},
+		"SELECT * FROM t WHERE a = :a AND b = :b_2":      {"a", "b_2"},
+		"SELECT * FROM t WHERE a = :a OR a2 = :a":        {"a"},
+		"SELECT a::text FROM t WHERE b = :b":             {"b"},
+		"SELECT * FROM t WHERE a = :user.id":             {"user.id"},
+		"SELECT * FROM t WHERE a = (:a)":                 {"a"},
+		"UPDATE t SET a := 1 WHERE b = :b":               {"b"},
+		"SELECT * FROM t WHERE a = :last":                {"last"},
+		"SELECT * FROM t WHERE a = :":                    {},
+		"SELECT * FROM t WHERE a = ANY(:ids) LIMIT :max": {"ids", "max"},
+	}
+	for query, expected := range cases {
+		names, err := NamedParameters(query)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, names, query)
+	}
+}
+
+func TestNamedParametersError(t *testing.T) {
+	_, err := NamedParameters("SELECT * FROM t WHERE a = :a::int")
+
+	assert.EqualError(t, err, "unexpected `:` while reading named param at 28")
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// QueryBindings maps query names to a value of the argument type each query is executed with, for use with QueryMap.CheckAllBindings.
+type QueryBindings map[string]interface{}
+
+// CheckBindings verifies, without a database, that an argument of type argType supplies every named parameter of the query, as sqlx requires when binding the argument. argType is a value, or nil pointer, of a struct type whose fields are mapped using "db" tags, a map[string]interface{} whose keys are checked, or a reflect.Type of a struct. Returns a *QueryError listing the parameters the argument does not supply, or an error if the query is not defined.
+func (q QueryMap) CheckBindings(name string, argType interface{}) error {
+	value, err := q.lookup(name)
+	if err != nil {
+		return err
+	}
+	params, err := NamedParameters(value.Query)
+	if err != nil {
+		return &QueryError{Name: name, Err: err}
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	if t, ok := argType.(reflect.Type); ok {
+		argType = reflect.New(t).Interface()
+	}
+	supplied, err := argSupplies(argType)
+	if err != nil {
+		return &QueryError{Name: name, Err: err}
+	}
+	var missing []string
+	for _, param := range params {
+		if !supplied(param) {
+			missing = append(missing, param)
+		}
+	}
+	if len(missing) > 0 {
+		return &QueryError{Name: name, Err: fmt.Errorf("%v does not supply parameters: %v", argTypeName(argType), strings.Join(missing, ", "))}
+	}
+	return nil
+}
+
+// CheckAllBindings checks the binding of every query in bindings, as CheckBindings does. Returns a QueryValidationError listing every incompatible query, ordered by name.
+func (q QueryMap) CheckAllBindings(bindings QueryBindings) error {
+	names := make([]string, 0, len(bindings))
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var queryErrors []*QueryError
+	for _, name := range names {
+		if err := q.CheckBindings(name, bindings[name]); err != nil {
+			queryErrors = append(queryErrors, bindingError(name, err))
+		}
+	}
+	if len(queryErrors) > 0 {
+		return &QueryValidationError{Errors: queryErrors}
+	}
+	return nil
+}
+
+// bindingError converts an error returned by CheckBindings into a *QueryError. An undefined query is reported using an error matching ErrQueryNotFound.
+func bindingError(name string, err error) *QueryError {
+	var queryErr *QueryError
+	if errors.As(err, &queryErr) {
+		return queryErr
+	}
+	var notFoundErr *QueryNotFoundError
+	if errors.As(err, &notFoundErr) {
+		return &QueryError{Name: name, Err: fmt.Errorf("%w%v", ErrQueryNotFound, notFoundErr.suggestion())}
+	}
+	return &QueryError{Name: name, Err: err}
+}
+
+// argTypeName returns the name of an argument type for error messages.
+func argTypeName(arg interface{}) string {
+	if arg == nil {
+		return "nil argument"
+	}
+	return reflect.TypeOf(arg).String()
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type bindingAudit struct {
+	CreatedBy string `db:"created_by"`
+}
+
+type bindingUser struct {
+	ID    int64 `db:"id"`
+	Name  string
+	Email string `db:"-"`
+	bindingAudit
+	Address struct {
+		City string `db:"city"`
+	} `db:"address"`
+}
+
+func TestCheckBindings(t *testing.T) {
+	// given
+	queryMap := QueryMap{
+		"Insert":     {Query: "INSERT INTO users (id, name, created_by, city) VALUES (:id, :name, :created_by, :address.city)"},
+		"FindEmail":  {Query: "SELECT id FROM users WHERE email = :email AND id = :id"},
+		"Count":      {Query: "SELECT count(*)::int FROM users"},
+		"BadParam":   {Query: "SELECT :a:b"},
+		"FindByName": {Query: "SELECT id FROM users WHERE name = :name"},
+	}
+
+	// then
+	assert.NoError(t, queryMap.CheckBindings("Insert", bindingUser{}))
+	assert.NoError(t, queryMap.CheckBindings("Insert", (*bindingUser)(nil)))
+	assert.NoError(t, queryMap.CheckBindings("Insert", reflect.TypeOf(bindingUser{})))
+	assert.NoError(t, queryMap.CheckBindings("Count", nil))
+	assert.NoError(t, queryMap.CheckBindings("FindByName", map[string]interface{}{"name": "a"}))
+	assert.EqualError(t, queryMap.CheckBindings("FindEmail", &bindingUser{}), "FindEmail: *dbx.bindingUser does not supply parameters: email")
+	assert.EqualError(t, queryMap.CheckBindings("FindByName", map[string]interface{}{}), "FindByName: map[string]interface {} does not supply parameters: name")
+	assert.EqualError(t, queryMap.CheckBindings("FindByName", nil), "FindByName: nil argument does not supply parameters: name")
+	assert.EqualError(t, queryMap.CheckBindings("FindByName", "name"), "FindByName: unsupported argument type string, expected a struct or map[string]interface{}")
+	assert.EqualError(t, queryMap.CheckBindings("BadParam", bindingUser{}), "BadParam: unexpected `:` while reading named param at 9")
+	assert.True(t, errors.Is(queryMap.CheckBindings("Inssert", bindingUser{}), ErrQueryNotFound))
+}
+
+func TestCheckAllBindings(t *testing.T) {
+	// given
+	queryMap := MustLoadNamedQueries("db/queries/test_queries.yaml")
+	type testRow struct {
+		ColA int64 `db:"cola"`
+	}
+
+	// when
+	validErr := queryMap.CheckAllBindings(QueryBindings{"FindTest": testRow{}, "InsertTest": &testRow{}})
+	invalidErr := queryMap.CheckAllBindings(QueryBindings{"FindTest": struct{ ColB int64 }{}, "InsertTst": testRow{}, "InsertTest": testRow{}})
+
+	// then
+	assert.NoError(t, validErr)
+	assert.EqualError(t, invalidErr, "2 named queries failed validation:\n  FindTest: struct { ColB int64 } does not supply parameters: cola\n  InsertTst: query not found, did you mean InsertTest?")
+	validationErr, ok := invalidErr.(*QueryValidationError)
+	assert.True(t, ok)
+	assert.True(t, errors.Is(validationErr.Errors[1], ErrQueryNotFound))
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Exec executes the named query, returning result metadata or an error. The query metadata is enforced as described by QueryMap.Get.
+func (q QueryMap) Exec(ctx context.Context, provider DBContextProvider, name string, arg interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := q.run(ctx, provider, name, arg, func(db DBContext, value QueryValue) error {
+		var err error
+		result, err = db.NamedExecContext(ctx, value.Query, namedArg(arg))
+		return err
+	})
+	return result, err
+}
+
+// Select executes the named query, scanning each returned row into dest, which must be a pointer to a slice. The query metadata is enforced as described by QueryMap.Get.
+func (q QueryMap) Select(ctx context.Context, provider DBContextProvider, dest interface{}, name string, arg interface{}) error {
+	return q.run(ctx, provider, name, arg, func(db DBContext, value QueryValue) error {
+		return selectRows(ctx, db, dest, value, arg)
+	})
+}
+
+// Get executes the named query, scanning the first returned row into dest, which is either a pointer to a struct or a pointer to a scannable value. Returns sql.ErrNoRows if the query returns no rows. The query metadata is enforced: the argument must supply every declared parameter, the returned columns must match any declared columns, and a query with a timeout runs in a transaction limited by SET LOCAL statement_timeout. A read only query without a timeout runs against provider.GetContext, which may be a replica, while a read only query with a timeout runs in a transaction begun with the ReadOnly transaction option when the provider is a TxContextProvider. All other queries run in a transaction begun by RunInTx. Errors are returned as a *QueryError naming the query.
+func (q QueryMap) Get(ctx context.Context, provider DBContextProvider, dest interface{}, name string, arg interface{}) error {
+	return q.run(ctx, provider, name, arg, func(db DBContext, value QueryValue) error {
+		return getRow(ctx, db, dest, value, arg)
+	})
+}
+
+// run looks up the named query, checks the argument against the declared parameters and invokes fn within the context required by the query metadata.
+func (q QueryMap) run(ctx context.Context, provider DBContextProvider, name string, arg interface{}, fn func(DBContext, QueryValue) error) error {
+	value, err := q.checkedQuery(name, arg)
+	if err != nil {
+		return err
+	}
+	return runQuery(ctx, provider, name, value, fn)
+}
+
+// checkedQuery looks up the named query, checking the argument against its declared parameters.
+func (q QueryMap) checkedQuery(name string, arg interface{}) (QueryValue, error) {
+	value, err := q.lookup(name)
+	if err != nil {
+		return QueryValue{}, err
+	}
+	if err := value.CheckArg(arg); err != nil {
+		return QueryValue{}, &QueryError{Name: name, Err: err}
+	}
+	return value, nil
+}
+
+// runQuery invokes fn within the context required by the query metadata, as described by QueryMap.Get. Any error, including an error obtaining the context, is returned as a *QueryError naming the query.
+func runQuery(ctx context.Context, provider DBContextProvider, name string, value QueryValue, fn func(DBContext, QueryValue) error) error {
+	var err error
+	if value.ReadOnly && value.Timeout <= 0 {
+		var db DBContext
+		if db, err = provider.GetContext(); err == nil {
+			err = fn(db, value)
+		}
+	} else {
+		opts := &sql.TxOptions{ReadOnly: value.ReadOnly}
+		if _, ok := provider.(TxContextProvider); !ok {
+			// the query does not depend on the read only option, which a provider without BeginTxContext cannot honor
+			opts = nil
+		}
+		err = RunInTx(ctx, provider, opts, func(tx DBTxContext) error {
+			return runWithTimeout(ctx, tx, value, fn)
+		})
+	}
+	if err != nil {
+		return &QueryError{Name: name, Err: err}
+	}
+	return nil
+}
+
+// runWithTimeout applies the timeout of the query to the transaction before invoking fn.
+func runWithTimeout(ctx context.Context, tx DBTxContext, value QueryValue, fn func(DBContext, QueryValue) error) error {
+	if value.Timeout > 0 {
+		if _, err := tx.NamedExecContext(ctx, value.statementTimeout(), namedArg(nil)); err != nil {
+			return err
+		}
+	}
+	return fn(tx, value)
+}
+
+// namedArg returns arg, substituting an empty map for a nil arg as sqlx is unable to bind a nil argument.
+func namedArg(arg interface{}) interface{} {
+	if arg == nil {
+		return map[string]interface{}{}
+	}
+	return arg
+}
+
+// queryRows executes a query returning rows, verifying the returned columns against any declared columns.
+func queryRows(ctx context.Context, db DBContext, value QueryValue, arg interface{}) (*sqlx.Rows, error) {
+	rows, err := db.NamedQueryContext(ctx, value.Query, namedArg(arg))
+	if err != nil {
+		return nil, err
+	}
+	columns, err := rows.Columns()
+	if err == nil {
+		err = value.CheckColumns(columns)
+	}
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	return rows, nil
+}
+
+// selectRows executes a query, scanning each returned row into dest, which must be a pointer to a slice of structs, scannable values, or pointers to either.
+func selectRows(ctx context.Context, db DBContext, dest interface{}, value QueryValue, arg interface{}) error {
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.IsNil() || slice.Elem().Kind() != reflect.Slice {
+		return errors.New("destination must be a non-nil pointer to a slice")
+	}
+	rows, err := queryRows(ctx, db, value, arg)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	slice = slice.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+	for rows.Next() {
+		elem := reflect.New(elemType)
+		if err := scanRow(rows, elem.Interface()); err != nil {
+			return err
+		}
+		if !isPtr {
+			elem = elem.Elem()
+		}
+		slice.Set(reflect.Append(slice, elem))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// getRow executes a query, scanning the first returned row into dest. Returns sql.ErrNoRows if the query returns no rows.
+func getRow(ctx context.Context, db DBContext, dest interface{}, value QueryValue, arg interface{}) error {
+	rows, err := queryRows(ctx, db, value, arg)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	if err := scanRow(rows, dest); err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// scanRow scans the current row into dest, using StructScan for structs that do not implement sql.Scanner and have mapped fields, such as time.Time, in the same manner as sqlx.Get.
+func scanRow(rows *sqlx.Rows, dest interface{}) error {
+	t := reflect.TypeOf(dest)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return errors.New("destination must be a non-nil pointer")
+	}
+	if t.Elem().Kind() == reflect.Struct && !t.Implements(scannerType) && len(argMapper.TypeMap(t.Elem()).Index) > 0 {
+		return rows.StructScan(dest)
+	}
+	return rows.Scan(dest)
+}
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
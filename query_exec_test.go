@@ -0,0 +1,231 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingContext records the statements executed against it.
+type recordingContext struct {
+	statements []string
+	committed  bool
+	rolledBack bool
+	err        error
+	commitErr  error
+	rbErr      error
+}
+
+func (c *recordingContext) NamedExec(query string, arg interface{}) (sql.Result, error) {
+	c.statements = append(c.statements, query)
+	return nil, c.err
+}
+
+func (c *recordingContext) NamedQuery(query string, arg interface{}) (*sqlx.Rows, error) {
+	c.statements = append(c.statements, query)
+	return nil, c.err
+}
+
+func (c *recordingContext) PrepareNamed(query string) (*sqlx.NamedStmt, error) {
+	return nil, c.err
+}
+
+func (c *recordingContext) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.NamedExec(query, arg)
+}
+
+func (c *recordingContext) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sqlx.Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.NamedQuery(query, arg)
+}
+
+func (c *recordingContext) PrepareNamedContext(ctx context.Context, query string) (*sqlx.NamedStmt, error) {
+	return c.PrepareNamed(query)
+}
+
+func (c *recordingContext) Commit() error {
+	c.committed = true
+	return c.commitErr
+}
+
+func (c *recordingContext) Rollback() error {
+	c.rolledBack = true
+	return c.rbErr
+}
+
+// recordingProvider hands out a single recording context for both reads and transactions.
+type recordingProvider struct {
+	context   *recordingContext
+	txStarted bool
+	txOptions *sql.TxOptions
+	err       error
+}
+
+func (p *recordingProvider) GetTxContext() (DBTxContext, error) {
+	return p.BeginTxContext(context.Background(), nil)
+}
+
+func (p *recordingProvider) BeginTxContext(ctx context.Context, opts *sql.TxOptions) (DBTxContext, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	p.txStarted = true
+	p.txOptions = opts
+	return p.context, nil
+}
+
+func (p *recordingProvider) GetContext() (DBContext, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.context, nil
+}
+
+func TestExecEnforcesMetadata(t *testing.T) {
+	// given
+	queryMap := QueryMap{
+		"Write":         {Query: "UPDATE test SET ColA = :cola"},
+		"Read":          {Query: "SELECT 1", ReadOnly: true},
+		"TimedRead":     {Query: "SELECT 2", ReadOnly: true, Timeout: 1500 * time.Millisecond},
+		"TimedWrite":    {Query: "DELETE FROM test", Timeout: time.Second},
+		"DeclaredParam": {Query: "UPDATE test SET ColA = :cola", Params: []QueryParam{{Name: "cola"}}},
+	}
+	cases := map[string]struct {
+		statements []string
+		txOptions  *sql.TxOptions
+	}{
+		"Write":      {[]string{"UPDATE test SET ColA = :cola"}, &sql.TxOptions{}},
+		"Read":       {[]string{"SELECT 1"}, nil},
+		"TimedRead":  {[]string{"SET LOCAL statement_timeout = 1500", "SELECT 2"}, &sql.TxOptions{ReadOnly: true}},
+		"TimedWrite": {[]string{"SET LOCAL statement_timeout = 1000", "DELETE FROM test"}, &sql.TxOptions{}},
+	}
+	for name, expected := range cases {
+		provider := &recordingProvider{context: &recordingContext{}}
+
+		// when
+		_, err := queryMap.Exec(context.Background(), provider, name, map[string]interface{}{})
+
+		// then
+		assert.NoError(t, err)
+		assert.Equal(t, expected.statements, provider.context.statements, name)
+		assert.Equal(t, expected.txOptions != nil, provider.txStarted, name)
+		assert.Equal(t, expected.txOptions, provider.txOptions, name)
+		assert.Equal(t, expected.txOptions != nil, provider.context.committed, name)
+	}
+
+	// when
+	provider := &recordingProvider{context: &recordingContext{}}
+	_, paramErr := queryMap.Exec(context.Background(), provider, "DeclaredParam", map[string]interface{}{})
+	_, missingErr := queryMap.Exec(context.Background(), provider, "Missing", nil)
+
+	// then
+	assert.EqualError(t, paramErr, "DeclaredParam: argument is missing declared parameters: cola")
+	assert.EqualError(t, missingErr, "Missing: query not found")
+	assert.Empty(t, provider.context.statements)
+}
+
+func TestExecWithoutTxOptions(t *testing.T) {
+	// given
+	queryMap := QueryMap{"TimedRead": {Query: "SELECT 2", ReadOnly: true, Timeout: time.Second}}
+	provider := &txContextProvider{context: &recordingContext{}}
+
+	// when
+	_, err := queryMap.Exec(context.Background(), provider, "TimedRead", nil)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"SET LOCAL statement_timeout = 1000", "SELECT 2"}, provider.context.statements)
+	assert.True(t, provider.context.committed)
+}
+
+func TestExecRollsBackOnError(t *testing.T) {
+	// given
+	queryMap := QueryMap{"Write": {Query: "UPDATE test SET ColA = 1"}}
+	provider := &recordingProvider{context: &recordingContext{err: errors.New("failed")}}
+
+	// when
+	_, err := queryMap.Exec(context.Background(), provider, "Write", nil)
+
+	// then
+	var queryErr *QueryError
+	assert.True(t, errors.As(err, &queryErr))
+	assert.Equal(t, "Write", queryErr.Name)
+	assert.True(t, provider.context.rolledBack)
+	assert.False(t, provider.context.committed)
+}
+
+func TestQueryErrorsNameTheQuery(t *testing.T) {
+	// given
+	queryMap := QueryMap{
+		"Read":  {Query: "SELECT 1", ReadOnly: true},
+		"Write": {Query: "UPDATE test SET ColA = 1"},
+	}
+	connErr := errors.New("connection refused")
+	provider := &recordingProvider{context: &recordingContext{}, err: connErr}
+	driverProvider := &recordingProvider{context: &recordingContext{err: errors.New("driver failure")}}
+	var dest int
+
+	// when
+	readErr := queryMap.Get(context.Background(), provider, &dest, "Read", nil)
+	writeErr := queryMap.Get(context.Background(), provider, &dest, "Write", nil)
+	driverErr := queryMap.Get(context.Background(), driverProvider, &dest, "Read", nil)
+
+	// then
+	assert.EqualError(t, readErr, "Read: connection refused")
+	assert.True(t, errors.Is(readErr, connErr))
+	assert.EqualError(t, writeErr, "Write: connection refused")
+	assert.EqualError(t, driverErr, "Read: driver failure")
+}
+
+func TestExecuteNamedQueries(t *testing.T) {
+	// given
+	db := setupTestDB(t, GenerateSchemaName("execschema"))
+	provider := NewDBProvider(db)
+	ctx := context.Background()
+	queryMap := MustLoadNamedQueries("db/queries/metadata_queries.json", "db/queries/metadata_queries.sql")
+
+	// when
+	_, insertErr := queryMap.Exec(context.Background(), provider, "InsertTest", map[string]interface{}{"cola": 200})
+	var rows []struct {
+		ColA int64 `db:"cola"`
+	}
+	selectErr := queryMap.Select(ctx, provider, &rows, "FindTest", map[string]interface{}{"cola": 200})
+	var count int64
+	countErr := queryMap.Get(ctx, provider, &count, "CountTest", nil)
+	noRowsErr := queryMap.Get(ctx, provider, &count, "FindTest", map[string]interface{}{"cola": 300})
+	columnsErr := queryMap.Select(ctx, provider, &rows, "FindWrongColumns", nil)
+
+	// then
+	assert.NoError(t, insertErr)
+	assert.NoError(t, selectErr)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, int64(200), rows[0].ColA)
+	assert.NoError(t, countErr)
+	assert.Equal(t, int64(2), count)
+	assert.True(t, errors.Is(noRowsErr, sql.ErrNoRows))
+	assert.EqualError(t, columnsErr, "FindWrongColumns: expected columns id but the query returned cola")
+}
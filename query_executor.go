@@ -0,0 +1,239 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// maxQuerySuggestions is the maximum number of similarly named queries suggested for an unknown query name.
+const maxQuerySuggestions = 3
+
+// ErrQueryNotFound is matched, using errors.Is, by the error returned when executing a query name that is not defined.
+var ErrQueryNotFound = errors.New("query not found")
+
+// QueryNotFoundError is returned when executing a query name that is not defined. Suggestions lists defined query names similar to the requested name, closest first.
+type QueryNotFoundError struct {
+	Name        string
+	Suggestions []string
+}
+
+// Error returns the requested name along with any suggestions.
+func (e *QueryNotFoundError) Error() string {
+	return fmt.Sprintf("%v: %v%v", e.Name, ErrQueryNotFound, e.suggestion())
+}
+
+// suggestion returns the suggested query names in the form ", did you mean A, B?", or an empty string if there are none.
+func (e *QueryNotFoundError) suggestion() string {
+	if len(e.Suggestions) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %v?", strings.Join(e.Suggestions, ", "))
+}
+
+// Is reports whether target is ErrQueryNotFound.
+func (e *QueryNotFoundError) Is(target error) bool {
+	return target == ErrQueryNotFound
+}
+
+// QueryExecutor executes the queries of a query map by name against a DBContext, which may be a database or a transaction, such as a DBTxContext passed to RunInTx. Declared parameters and columns are checked as they are by QueryMap.Get. A query timeout is applied with SET LOCAL statement_timeout when the executor is bound to a transaction, in which case the timeout remains in effect for the rest of the transaction, and otherwise by cancelling the context of the query once the timeout elapses. As every query runs against the bound context, read only queries are not routed to a separate context. Errors returned by the database are wrapped in a *QueryError naming the query.
+type QueryExecutor struct {
+	queries QueryMap
+	db      DBContext
+	stats   *QueryStats
+}
+
+// NewQueryExecutor returns an executor of the queries against db, which may be a database or a transaction.
+func NewQueryExecutor(queries QueryMap, db DBContext) *QueryExecutor {
+	return &QueryExecutor{queries: queries, db: db}
+}
+
+// WithTx returns a copy of the executor that executes queries within the given transaction, for example one passed to the function run by RunInTx.
+func (e *QueryExecutor) WithTx(tx DBTxContext) *QueryExecutor {
+	bound := *e
+	bound.db = tx
+	return &bound
+}
+
+// WithStats returns a copy of the executor that records the call count, error count and latency of each query it executes in stats.
+func (e *QueryExecutor) WithStats(stats *QueryStats) *QueryExecutor {
+	instrumented := *e
+	instrumented.stats = stats
+	return &instrumented
+}
+
+// Exec executes the named query, returning result metadata or an error.
+func (e *QueryExecutor) Exec(ctx context.Context, name string, arg interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := e.run(ctx, name, arg, func(ctx context.Context, value QueryValue) error {
+		var err error
+		result, err = e.db.NamedExecContext(ctx, value.Query, namedArg(arg))
+		return err
+	})
+	return result, err
+}
+
+// Query executes the named query, returning the rows returned by the database or an error. As the rows outlive the call, a query timeout is only applied when the executor is bound to a transaction.
+func (e *QueryExecutor) Query(ctx context.Context, name string, arg interface{}) (*sqlx.Rows, error) {
+	value, err := e.queries.checkedQuery(name, arg)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	var rows *sqlx.Rows
+	if tx, ok := e.db.(DBTxContext); ok && value.Timeout > 0 {
+		_, err = tx.NamedExecContext(ctx, value.statementTimeout(), namedArg(nil))
+	}
+	if err == nil {
+		rows, err = queryRows(ctx, e.db, value, arg)
+	}
+	if err != nil {
+		err = &QueryError{Name: name, Err: err}
+	}
+	e.record(name, start, err)
+	return rows, err
+}
+
+// Get executes the named query, scanning the first returned row into dest, which is either a pointer to a struct or a pointer to a scannable value. Returns an error matching sql.ErrNoRows if the query returns no rows.
+func (e *QueryExecutor) Get(ctx context.Context, dest interface{}, name string, arg interface{}) error {
+	return e.run(ctx, name, arg, func(ctx context.Context, value QueryValue) error {
+		return getRow(ctx, e.db, dest, value, arg)
+	})
+}
+
+// Select executes the named query, scanning each returned row into dest, which must be a pointer to a slice.
+func (e *QueryExecutor) Select(ctx context.Context, dest interface{}, name string, arg interface{}) error {
+	return e.run(ctx, name, arg, func(ctx context.Context, value QueryValue) error {
+		return selectRows(ctx, e.db, dest, value, arg)
+	})
+}
+
+// run looks up the named query, checks the argument against the declared parameters and invokes fn with the query timeout applied, recording the execution if the executor is instrumented.
+func (e *QueryExecutor) run(ctx context.Context, name string, arg interface{}, fn func(context.Context, QueryValue) error) error {
+	value, err := e.queries.checkedQuery(name, arg)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	if err = e.runWithTimeout(ctx, value, fn); err != nil {
+		err = &QueryError{Name: name, Err: err}
+	}
+	e.record(name, start, err)
+	return err
+}
+
+// runWithTimeout invokes fn, applying the query timeout with SET LOCAL statement_timeout if the executor is bound to a transaction, or otherwise with a context deadline.
+func (e *QueryExecutor) runWithTimeout(ctx context.Context, value QueryValue, fn func(context.Context, QueryValue) error) error {
+	if value.Timeout <= 0 {
+		return fn(ctx, value)
+	}
+	if tx, ok := e.db.(DBTxContext); ok {
+		return runWithTimeout(ctx, tx, value, func(DBContext, QueryValue) error {
+			return fn(ctx, value)
+		})
+	}
+	ctx, cancel := context.WithTimeout(ctx, value.Timeout)
+	defer cancel()
+	return fn(ctx, value)
+}
+
+// record records an execution of the named query that started at start, if the executor is instrumented. A query returning no rows is not counted as an error.
+func (e *QueryExecutor) record(name string, start time.Time, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	if e.stats != nil {
+		e.stats.Record(name, time.Since(start), err)
+	}
+}
+
+// lookup returns the named query, or a *QueryNotFoundError suggesting similarly named queries if there is no query by that name.
+func (q QueryMap) lookup(name string) (QueryValue, error) {
+	value, ok := q[name]
+	if !ok {
+		return QueryValue{}, &QueryNotFoundError{Name: name, Suggestions: q.suggest(name)}
+	}
+	return value, nil
+}
+
+// suggest returns the query names closest to name by edit distance, ignoring case. A qualified name is also compared by its unqualified part, so that a name missing its namespace is suggested.
+func (q QueryMap) suggest(name string) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	target := strings.ToLower(name)
+	maxDistance := len(target)/3 + 1
+	var candidates []candidate
+	for defined := range q {
+		lower := strings.ToLower(defined)
+		distance := editDistance(target, lower)
+		if idx := strings.LastIndex(lower, "."); idx >= 0 {
+			if unqualified := editDistance(target, lower[idx+1:]); unqualified < distance {
+				distance = unqualified
+			}
+		}
+		if distance <= maxDistance {
+			candidates = append(candidates, candidate{name: defined, distance: distance})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+	var suggestions []string
+	for i := 0; i < len(candidates) && i < maxQuerySuggestions; i++ {
+		suggestions = append(suggestions, candidates[i].name)
+	}
+	return suggestions
+}
+
+// editDistance returns the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	previous := make([]int, len(t)+1)
+	current := make([]int, len(t)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		current[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(t)]
+}
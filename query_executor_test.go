@@ -0,0 +1,173 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryNotFoundSuggestions(t *testing.T) {
+	// given
+	queryMap := QueryMap{
+		"FindUser":           {},
+		"FindUsers":          {},
+		"users.FindByID":     {},
+		"InsertOrder":        {},
+		"orders.FindByOwner": {},
+	}
+	cases := map[string]string{
+		"FindUsr":   "FindUsr: query not found, did you mean FindUser, FindUsers?",
+		"finduser":  "finduser: query not found, did you mean FindUser, FindUsers?",
+		"FindByID":  "FindByID: query not found, did you mean users.FindByID?",
+		"DropTable": "DropTable: query not found",
+	}
+	for name, expected := range cases {
+		// when
+		_, err := queryMap.lookup(name)
+
+		// then
+		assert.EqualError(t, err, expected)
+		assert.True(t, errors.Is(err, ErrQueryNotFound))
+	}
+}
+
+func TestQueryExecutorErrors(t *testing.T) {
+	// given
+	db := &recordingContext{}
+	executor := NewQueryExecutor(QueryMap{
+		"Insert":      {Query: "INSERT INTO test (ColA) VALUES (:cola)", Params: []QueryParam{{Name: "cola"}}},
+		"InsertOther": {Query: "INSERT INTO other (ColA) VALUES (:cola)"},
+	}, db)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// when
+	_, missingErr := executor.Exec(context.Background(), "Insrt", nil)
+	_, paramErr := executor.Exec(context.Background(), "Insert", map[string]interface{}{})
+	_, canceledErr := executor.Exec(ctx, "Insert", map[string]interface{}{"cola": 1})
+	db.err = errors.New("relation \"other\" does not exist")
+	_, dbErr := executor.Exec(context.Background(), "InsertOther", map[string]interface{}{"cola": 1})
+
+	// then
+	var notFoundErr *QueryNotFoundError
+	assert.True(t, errors.As(missingErr, &notFoundErr))
+	assert.Equal(t, []string{"Insert"}, notFoundErr.Suggestions)
+	assert.EqualError(t, paramErr, "Insert: argument is missing declared parameters: cola")
+	assert.True(t, errors.Is(canceledErr, context.Canceled))
+	assert.EqualError(t, dbErr, "InsertOther: relation \"other\" does not exist")
+	assert.Equal(t, []string{"INSERT INTO other (ColA) VALUES (:cola)"}, db.statements)
+}
+
+// deadlineContext exposes only the DBContext methods of a recording context, recording whether a statement was executed with a deadline.
+type deadlineContext struct {
+	DBContext
+	deadline bool
+}
+
+func (c *deadlineContext) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	_, c.deadline = ctx.Deadline()
+	return c.DBContext.NamedExecContext(ctx, query, arg)
+}
+
+func TestQueryExecutorTimeout(t *testing.T) {
+	// given
+	queryMap := QueryMap{
+		"Write":      {Query: "DELETE FROM test"},
+		"TimedWrite": {Query: "DELETE FROM test", Timeout: time.Second},
+	}
+	tx := &recordingContext{}
+	recording := &recordingContext{}
+	db := &deadlineContext{DBContext: recording}
+
+	// when
+	_, txErr := NewQueryExecutor(queryMap, db).WithTx(tx).Exec(context.Background(), "TimedWrite", nil)
+	_, dbErr := NewQueryExecutor(queryMap, db).Exec(context.Background(), "TimedWrite", nil)
+
+	// then the timeout is applied to the transaction, which is left open
+	assert.NoError(t, txErr)
+	assert.Equal(t, []string{"SET LOCAL statement_timeout = 1000", "DELETE FROM test"}, tx.statements)
+	assert.False(t, tx.committed)
+	assert.False(t, tx.rolledBack)
+
+	// then the timeout is applied with a deadline outside of a transaction
+	assert.NoError(t, dbErr)
+	assert.Equal(t, []string{"DELETE FROM test"}, recording.statements)
+	assert.True(t, db.deadline)
+
+	// when
+	_, err := NewQueryExecutor(queryMap, db).Exec(context.Background(), "Write", nil)
+
+	// then
+	assert.NoError(t, err)
+	assert.False(t, db.deadline)
+}
+
+func TestQueryExecutor(t *testing.T) {
+	// given
+	db := setupTestDB(t, GenerateSchemaName("executorschema"))
+	executor := NewQueryExecutor(QueryMap{
+		"Insert": {Query: "INSERT INTO test (ColA) VALUES (:cola)"},
+		"Find":   {Query: "SELECT ColA FROM test WHERE ColA = :cola"},
+		"All":    {Query: "SELECT ColA FROM test ORDER BY ColA"},
+		"Sleep":  {Query: "SELECT pg_sleep(1)", Timeout: 10 * time.Millisecond},
+	}, db)
+	ctx := context.Background()
+
+	// when
+	_, insertErr := executor.Exec(ctx, "Insert", map[string]interface{}{"cola": 200})
+	var colA int64
+	getErr := executor.Get(ctx, &colA, "Find", map[string]interface{}{"cola": 200})
+	noRowsErr := executor.Get(ctx, &colA, "Find", map[string]interface{}{"cola": 300})
+	var all []int64
+	selectErr := executor.Select(ctx, &all, "All", nil)
+	rows, queryErr := executor.Query(ctx, "All", nil)
+	sleepErr := executor.Get(ctx, new(string), "Sleep", nil)
+	_, duplicateErr := executor.Exec(ctx, "Insert", map[string]interface{}{"cola": 200})
+
+	// then
+	assert.NoError(t, insertErr)
+	assert.NoError(t, getErr)
+	assert.Equal(t, int64(200), colA)
+	assert.True(t, errors.Is(noRowsErr, sql.ErrNoRows))
+	assert.NoError(t, selectErr)
+	assert.Equal(t, []int64{100, 200}, all)
+	require.NoError(t, queryErr)
+	assert.True(t, rows.Next())
+	rows.Close()
+	assert.Error(t, sleepErr)
+	var queryError *QueryError
+	assert.True(t, errors.As(duplicateErr, &queryError))
+	assert.Equal(t, "Insert", queryError.Name)
+
+	// when executing within a transaction
+	txErr := RunInTx(ctx, NewDBProvider(db), nil, func(tx DBTxContext) error {
+		txExecutor := executor.WithTx(tx)
+		if _, err := txExecutor.Exec(ctx, "Insert", map[string]interface{}{"cola": 300}); err != nil {
+			return err
+		}
+		return txExecutor.Get(ctx, new(string), "Sleep", nil)
+	})
+
+	// then the timeout applies within the transaction, which is rolled back
+	assert.Error(t, txErr)
+	assert.True(t, errors.Is(executor.Get(ctx, &colA, "Find", map[string]interface{}{"cola": 300}), sql.ErrNoRows))
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// fragmentReference matches a {{fragment "name"}} reference. Only fragment references are recognized, so that other uses of braces, such as Postgres array literals, are left untouched.
+var fragmentReference = regexp.MustCompile(`\{\{\s*fragment\s+"([^"]+)"\s*\}\}`)
+
+// loadedFragment is a fragment along with the namespace and location it was loaded from.
+type loadedFragment struct {
+	text      string
+	namespace string
+	source    QuerySource
+}
+
+// addFragment adds a parsed fragment under its fully qualified name, enforcing the duplicate rules of the load options.
+func (l *queryLoader) addFragment(file, namespace string, fragment queryFragment) error {
+	name := qualifyName(namespace, fragment.name)
+	loaded := loadedFragment{
+		text:      fragment.text,
+		namespace: namespace,
+		source:    QuerySource{File: file, Line: fragment.line},
+	}
+	if previous, exists := l.fragments[name]; exists && l.options.Strict {
+		if !l.options.Override || previous.source.File == file {
+			return fmt.Errorf("duplicate fragment %v defined at %v and %v", name, previous.source, loaded.source)
+		}
+	}
+	l.fragments[name] = loaded
+	return nil
+}
+
+// expandFragments replaces the fragment references of every loaded query with the fragment SQL.
+func (l *queryLoader) expandFragments() error {
+	for name, value := range l.queries {
+		if !fragmentReference.MatchString(value.RawQuery) {
+			continue
+		}
+		expanded, err := l.expand(value.RawQuery, l.namespaces[name], nil)
+		if err != nil {
+			return fmt.Errorf("%v: query %v: %w", value.Source, name, err)
+		}
+		value.Query = expanded
+		l.queries[name] = value
+	}
+	return nil
+}
+
+// expand recursively expands the fragment references within text. References are resolved within namespace before being resolved as fully qualified names. The chain of fragments being expanded is used to detect cycles.
+func (l *queryLoader) expand(text, namespace string, expanding []string) (string, error) {
+	var expandErr error
+	expanded := fragmentReference.ReplaceAllStringFunc(text, func(reference string) string {
+		if expandErr != nil {
+			return reference
+		}
+		name, fragment, ok := l.lookupFragment(fragmentReference.FindStringSubmatch(reference)[1], namespace)
+		if !ok {
+			expandErr = fmt.Errorf("undefined fragment: %v", fragmentReference.FindStringSubmatch(reference)[1])
+			return reference
+		}
+		for _, current := range expanding {
+			if current == name {
+				expandErr = fmt.Errorf("fragment cycle: %v -> %v", strings.Join(expanding, " -> "), name)
+				return reference
+			}
+		}
+		result, err := l.expand(fragment.text, fragment.namespace, append(expanding, name))
+		if err != nil {
+			expandErr = err
+			return reference
+		}
+		return result
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+	return expanded, nil
+}
+
+// lookupFragment resolves a fragment reference, first within the given namespace and then as a fully qualified name.
+func (l *queryLoader) lookupFragment(reference, namespace string) (string, loadedFragment, bool) {
+	if namespace != "" {
+		qualified := qualifyName(namespace, reference)
+		if fragment, ok := l.fragments[qualified]; ok {
+			return qualified, fragment, true
+		}
+	}
+	fragment, ok := l.fragments[reference]
+	return reference, fragment, ok
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadQueriesWithFragments(t *testing.T) {
+	// when
+	queryMap, err := LoadNamedQueriesWithOptions(QueryLoadOptions{Strict: true}, "db/queries/fragments/users.json")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(queryMap))
+	value := queryMap["users.FindByID"]
+	assert.Equal(t, "SELECT id, name, created_at, updated_at FROM users WHERE id = :id AND tenant_id = :tenant_id", value.Query)
+	assert.Equal(t, "SELECT {{fragment \"columns\"}} FROM users WHERE id = :id AND {{ fragment \"tenant_filter\" }}", value.RawQuery)
+	assert.Equal(t, value.Query, queryMap.Q("users.FindByID"))
+	assert.Equal(t, "SELECT id FROM users WHERE tags && '{{a,b}}'", queryMap.Q("users.FindByTags"))
+}
+
+func TestLoadQueriesWithFragmentsFromYAML(t *testing.T) {
+	// given
+	fsys := fstest.MapFS{
+		"queries.yaml": {Data: []byte("$fragments:\n  one: |-\n    1\nQ:\n  query: SELECT {{fragment \"one\"}}\n")},
+	}
+
+	// when
+	queryMap, err := LoadNamedQueriesFS(fsys, "queries.yaml")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT 1", queryMap.Q("Q"))
+}
+
+func TestLoadQueriesWithFragmentErrors(t *testing.T) {
+	// given
+	fsys := fstest.MapFS{
+		"undefined.sql": {Data: []byte("-- name: Q\nSELECT {{fragment \"missing\"}}\n")},
+		"cycle.sql":     {Data: []byte("-- fragment: a\n{{fragment \"b\"}}\n-- fragment: b\n{{fragment \"a\"}}\n-- name: Q\nSELECT {{fragment \"a\"}}\n")},
+		"duplicate.sql": {Data: []byte("-- fragment: a\n1\n-- fragment: a\n2\n")},
+	}
+
+	// when
+	_, undefinedErr := LoadNamedQueriesFS(fsys, "undefined.sql")
+	_, cycleErr := LoadNamedQueriesFS(fsys, "cycle.sql")
+	_, duplicateErr := LoadNamedQueriesWithOptions(QueryLoadOptions{FS: fsys, Strict: true}, "duplicate.sql")
+
+	// then
+	assert.EqualError(t, undefinedErr, "undefined.sql:1: query Q: undefined fragment: missing")
+	assert.EqualError(t, cycleErr, "cycle.sql:5: query Q: fragment cycle: a -> b -> a")
+	assert.EqualError(t, duplicateErr, "duplicate fragment a defined at duplicate.sql:1 and duplicate.sql:3")
+}
@@ -0,0 +1,321 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Query lint rules.
+const (
+	// LintSelectStar flags queries selecting every column with SELECT *, which break when columns are added or reordered.
+	LintSelectStar = "select-star"
+	// LintUnfilteredWrite flags UPDATE and DELETE statements without a WHERE clause.
+	LintUnfilteredWrite = "unfiltered-write"
+	// LintUnusedParam flags declared parameters that the query never references.
+	LintUnusedParam = "unused-param"
+	// LintMixedPlaceholders flags queries mixing positional $1 placeholders with :name parameters.
+	LintMixedPlaceholders = "mixed-placeholders"
+	// LintEmptyDescription flags queries without a description.
+	LintEmptyDescription = "empty-description"
+)
+
+// LintRules lists every query lint rule.
+var LintRules = []string{LintSelectStar, LintUnfilteredWrite, LintUnusedParam, LintMixedPlaceholders, LintEmptyDescription}
+
+// LintOptions configures the rules applied by QueryMap.Lint.
+type LintOptions struct {
+	// Disabled lists the rules that are not applied.
+	Disabled []string
+}
+
+// LintIssue is a problem found in a named query. File and Line locate the offending statement or declared parameter where the query file allows it, and otherwise the query definition.
+type LintIssue struct {
+	Rule    string `json:"rule"`
+	Query   string `json:"query"`
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// String formats the issue as "file:line: query Name: message (rule)".
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%v:%d: query %v: %v (%v)", i.File, i.Line, i.Query, i.Message, i.Rule)
+}
+
+// Lint checks every query for common SQL mistakes, returning the issues found ordered by file, line and query name. Returns an error if a disabled rule is unknown.
+func (q QueryMap) Lint(opts LintOptions) ([]LintIssue, error) {
+	disabled := make(map[string]bool, len(opts.Disabled))
+	for _, rule := range opts.Disabled {
+		if !isLintRule(rule) {
+			return nil, fmt.Errorf("unknown lint rule: %v", rule)
+		}
+		disabled[rule] = true
+	}
+	var issues []LintIssue
+	for name, value := range q {
+		for _, issue := range lintQuery(value) {
+			if disabled[issue.Rule] {
+				continue
+			}
+			issue.Query, issue.File = name, value.Source.File
+			if issue.Line == 0 {
+				issue.Line = value.Source.Line
+			}
+			issues = append(issues, issue)
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		a, b := issues[i], issues[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Query != b.Query {
+			return a.Query < b.Query
+		}
+		return a.Rule < b.Rule
+	})
+	return issues, nil
+}
+
+func isLintRule(rule string) bool {
+	for _, known := range LintRules {
+		if rule == known {
+			return true
+		}
+	}
+	return false
+}
+
+// lintQuery applies every rule to a query, returning issues holding the rule, message and, where known, the line of the offending statement or parameter.
+func lintQuery(value QueryValue) []LintIssue {
+	var issues []LintIssue
+	add := func(rule string, line int, format string, args ...interface{}) {
+		issues = append(issues, LintIssue{Rule: rule, Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+	// lineOf returns the line of the file on which a token begins, or zero if unknown, as when fragments were expanded into the query text
+	lineOf := func(token *sqlToken) int {
+		if value.Source.QueryLine == 0 || value.Query != value.RawQuery {
+			return 0
+		}
+		return value.Source.QueryLine + token.line
+	}
+	tokens := tokenizeSQL(value.Query)
+	depth := 0
+	var previous, statementToken, positional *sqlToken
+	statement, filtered := "", false
+	endStatement := func() {
+		if statement != "" && !filtered {
+			add(LintUnfilteredWrite, lineOf(statementToken), "%v without a WHERE clause", statement)
+		}
+		statement, filtered = "", false
+	}
+	for i := range tokens {
+		token := &tokens[i]
+		switch {
+		case token.is("("):
+			depth++
+		case token.is(")"):
+			depth--
+		case token.is(";"):
+			endStatement()
+		case token.kind == sqlPositional && positional == nil:
+			positional = token
+		case token.is("*") && previous != nil && (previous.is("SELECT") || previous.is("DISTINCT") || previous.is("ALL")):
+			add(LintSelectStar, lineOf(token), "SELECT * selects every column, list the columns instead")
+		case depth == 0 && (token.is("UPDATE") || token.is("DELETE")) && (previous == nil || previous.is(";") || previous.is(")")):
+			endStatement()
+			statement, statementToken = strings.ToUpper(token.text), token
+		case depth == 0 && token.is("WHERE"):
+			filtered = true
+		}
+		previous = token
+	}
+	endStatement()
+	params, _ := NamedParameters(value.Query)
+	used := make(map[string]bool, len(params))
+	for _, param := range params {
+		used[param] = true
+	}
+	for _, param := range value.Params {
+		if !used[param.Name] {
+			add(LintUnusedParam, value.Source.ParamsLine, "declared parameter %v is never used", param.Name)
+		}
+	}
+	if positional != nil && len(params) > 0 {
+		add(LintMixedPlaceholders, lineOf(positional), "mixes positional $n placeholders with :name parameters")
+	}
+	if strings.TrimSpace(value.Description) == "" {
+		add(LintEmptyDescription, 0, "has no description")
+	}
+	return issues
+}
+
+// sqlTokenKind classifies a SQL token.
+type sqlTokenKind int
+
+const (
+	sqlWord sqlTokenKind = iota
+	sqlQuotedIdentifier
+	sqlString
+	sqlNumber
+	sqlPositional
+	sqlSymbol
+)
+
+// sqlToken is a lexical token of a SQL statement. Comments and whitespace are not tokens.
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	// line is the zero based line of the statement on which the token begins
+	line int
+}
+
+// is reports whether the token is the given keyword, ignoring case, or symbol.
+func (t *sqlToken) is(text string) bool {
+	return (t.kind == sqlWord || t.kind == sqlSymbol) && strings.EqualFold(t.text, text)
+}
+
+// tokenizeSQL splits a Postgres statement into tokens, skipping comments and whitespace. String literals, including escape and dollar quoted strings, and quoted identifiers are single tokens, so that their contents are never mistaken for keywords. Unterminated literals extend to the end of the statement.
+func tokenizeSQL(query string) []sqlToken {
+	runes := []rune(query)
+	var tokens []sqlToken
+	// line counts the newlines preceding counted, the start of the last emitted token
+	line, counted := 0, 0
+	emit := func(kind sqlTokenKind, start, end int) {
+		for ; counted < start; counted++ {
+			if runes[counted] == '\n' {
+				line++
+			}
+		}
+		tokens = append(tokens, sqlToken{kind: kind, text: string(runes[start:end]), line: line})
+	}
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			i = skipPast(runes, i, "\n")
+			continue
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			i = skipBlockComment(runes, i)
+			continue
+		case r == '\'':
+			i = skipQuoted(runes, i, '\'', i > 0 && (runes[i-1] == 'E' || runes[i-1] == 'e'))
+			emit(sqlString, start, i)
+			continue
+		case r == '"':
+			i = skipQuoted(runes, i, '"', false)
+			emit(sqlQuotedIdentifier, start, i)
+			continue
+		case r == '$' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			for i++; i < len(runes) && unicode.IsDigit(runes[i]); i++ {
+			}
+			emit(sqlPositional, start, i)
+			continue
+		case r == '$':
+			if tag, ok := dollarQuoteTag(runes, i); ok {
+				i = skipPast(runes, i+len([]rune(tag)), tag)
+				emit(sqlString, start, i)
+				continue
+			}
+		case unicode.IsLetter(r) || r == '_':
+			for i++; i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '$'); i++ {
+			}
+			if i < len(runes) && runes[i] == '\'' && i-start == 1 && (r == 'E' || r == 'e') {
+				// an escape string, tokenized as a string by the next iteration
+				continue
+			}
+			emit(sqlWord, start, i)
+			continue
+		case unicode.IsDigit(r):
+			for i++; i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.'); i++ {
+			}
+			emit(sqlNumber, start, i)
+			continue
+		}
+		i++
+		emit(sqlSymbol, start, i)
+	}
+	return tokens
+}
+
+// skipPast returns the index just past the first occurrence of the terminator at or after start, or the end of the query if there is none.
+func skipPast(runes []rune, start int, terminator string) int {
+	end := []rune(terminator)
+	for i := start; i+len(end) <= len(runes); i++ {
+		if string(runes[i:i+len(end)]) == terminator {
+			return i + len(end)
+		}
+	}
+	return len(runes)
+}
+
+// skipQuoted returns the index just past the quoted text starting at start, where a doubled quote is an escaped quote, as is a backslash escaped quote within an escape string.
+func skipQuoted(runes []rune, start int, quote rune, backslashEscapes bool) int {
+	for i := start + 1; i < len(runes); i++ {
+		switch {
+		case backslashEscapes && runes[i] == '\\':
+			i++
+		case runes[i] == quote && i+1 < len(runes) && runes[i+1] == quote:
+			i++
+		case runes[i] == quote:
+			return i + 1
+		}
+	}
+	return len(runes)
+}
+
+// skipBlockComment returns the index just past the block comment starting at start. Postgres block comments nest.
+func skipBlockComment(runes []rune, start int) int {
+	depth := 0
+	for i := start; i+1 < len(runes); i++ {
+		switch {
+		case runes[i] == '/' && runes[i+1] == '*':
+			depth++
+			i++
+		case runes[i] == '*' && runes[i+1] == '/':
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(runes)
+}
+
+// dollarQuoteTag returns the opening tag, such as "$$" or "$body$", of a dollar quoted string starting at start.
+func dollarQuoteTag(runes []rune, start int) (string, bool) {
+	for i := start + 1; i < len(runes); i++ {
+		switch {
+		case runes[i] == '$':
+			return string(runes[start : i+1]), true
+		case !(unicode.IsLetter(runes[i]) || runes[i] == '_' || (i > start+1 && unicode.IsDigit(runes[i]))):
+			return "", false
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintQueries(t *testing.T) {
+	// given
+	queryMap := MustLoadNamedQueries("db/queries/lint_queries.sql")
+
+	// when
+	issues, err := queryMap.Lint(LintOptions{})
+
+	// then
+	assert.NoError(t, err)
+	file := "db/queries/lint_queries.sql"
+	assert.Equal(t, []LintIssue{
+		{Rule: LintSelectStar, Query: "FindAll", File: file, Line: 3, Message: "SELECT * selects every column, list the columns instead"},
+		{Rule: LintUnfilteredWrite, Query: "DeleteAll", File: file, Line: 7, Message: "DELETE without a WHERE clause"},
+		{Rule: LintEmptyDescription, Query: "UpdateMixed", File: file, Line: 9, Message: "has no description"},
+		{Rule: LintUnusedParam, Query: "UpdateMixed", File: file, Line: 10, Message: "declared parameter colb is never used"},
+		{Rule: LintMixedPlaceholders, Query: "UpdateMixed", File: file, Line: 11, Message: "mixes positional $n placeholders with :name parameters"},
+	}, issues)
+	assert.Equal(t, "db/queries/lint_queries.sql:3: query FindAll: SELECT * selects every column, list the columns instead (select-star)", issues[0].String())
+}
+
+func TestLintIssueLines(t *testing.T) {
+	// given
+	fsys := fstest.MapFS{
+		"q.yaml": {Data: []byte("Purge:\n  description: Purges rows\n  params:\n    - name: cola\n  query: |\n    UPDATE test SET ColA = 1 WHERE ColA = 2;\n    DELETE FROM test\nFindAll:\n  description: Finds rows\n  query: SELECT * FROM test\n")},
+		"q.json": {Data: []byte("{\n\"FindOne\": {\n  \"description\": \"Finds a row\",\n  \"query\": \"SELECT * FROM test LIMIT 1\"\n},\n\"PurgeAll\": {\n  \"description\": \"Purges rows\",\n  \"query\": \"SELECT 1;\\nDELETE FROM test\"\n}\n}")},
+		"q.sql":  {Data: []byte("-- name: DeleteSelected\n-- description: Deletes rows\n\n{{fragment \"Select\"}};\nDELETE FROM test\n\n-- fragment: Select\nSELECT 1\n")},
+	}
+	queryMap, err := LoadNamedQueriesWithOptions(QueryLoadOptions{FS: fsys}, "q.yaml", "q.json", "q.sql")
+	assert.NoError(t, err)
+
+	// when
+	issues, lintErr := queryMap.Lint(LintOptions{})
+
+	// then
+	assert.NoError(t, lintErr)
+	lines := make(map[string]int)
+	for _, issue := range issues {
+		lines[issue.Query+" "+issue.Rule] = issue.Line
+	}
+	assert.Equal(t, map[string]int{
+		// the lines of a literal block scalar correspond to lines of the file
+		"Purge unused-param":     4,
+		"Purge unfiltered-write": 7,
+		"FindAll select-star":    10,
+		// a single line JSON string is attributed to its line, while a string spanning several lines is attributed to the query
+		"FindOne select-star":       4,
+		"PurgeAll unfiltered-write": 6,
+		// expanded fragments are attributed to the query
+		"DeleteSelected unfiltered-write": 1,
+	}, lines)
+}
+
+func TestLintDisabledRules(t *testing.T) {
+	// given
+	queryMap := MustLoadNamedQueries("db/queries/lint_queries.sql")
+
+	// when
+	issues, err := queryMap.Lint(LintOptions{Disabled: []string{LintSelectStar, LintEmptyDescription, LintMixedPlaceholders, LintUnusedParam}})
+	_, unknownErr := queryMap.Lint(LintOptions{Disabled: []string{"select-all"}})
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, issues, 1)
+	assert.Equal(t, LintUnfilteredWrite, issues[0].Rule)
+	assert.EqualError(t, unknownErr, "unknown lint rule: select-all")
+}
+
+func TestLintStatements(t *testing.T) {
+	cases := map[string][]string{
+		"SELECT DISTINCT * FROM t": {LintSelectStar},
+		"SELECT t.* FROM t":        nil,
+		"SELECT a * 2 FROM t":      nil,
+		"WITH d AS (DELETE FROM t WHERE a = 1 RETURNING a) UPDATE u SET a = 1":  {LintUnfilteredWrite},
+		"WITH d AS (SELECT 1) DELETE FROM t WHERE a IN (SELECT 1 FROM d)":       nil,
+		"INSERT INTO t VALUES (1) ON CONFLICT (a) DO UPDATE SET b = 2":          nil,
+		"UPDATE t SET a = 1 WHERE b = 2; DELETE FROM t":                         {LintUnfilteredWrite},
+		"SELECT E'it\\'s SELECT *', \"SELECT * \"\"x\" FROM t -- DELETE FROM t": nil,
+		"SELECT a::text FROM t WHERE b = $1":                                    nil,
+	}
+	for query, expected := range cases {
+		var rules []string
+		for _, issue := range lintQuery(QueryValue{Query: query, Description: "d"}) {
+			rules = append(rules, issue.Rule)
+		}
+		assert.Equal(t, expected, rules, query)
+	}
+}
@@ -15,15 +15,60 @@
 package dbx
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
-// QueryValue is a structure representing the unmarshalled json query object.
+// QueryValue is a structure representing the unmarshalled json or yaml query object.
 type QueryValue struct {
-	Query       string `json:"query"`
-	Description string `json:"description"`
+	Query       string `json:"query" yaml:"query"`
+	Description string `json:"description" yaml:"description"`
+	// RawQuery holds the query as written in the query file, before any fragment references are expanded into Query.
+	RawQuery string `json:"-" yaml:"-"`
+	// Variants holds the dialect specific bodies of a query, keyed by lower case dialect name, if the query was defined with variants. Query holds the variant selected at load time.
+	Variants map[string]string `json:"-" yaml:"-"`
+	// Params declares the named parameters of the query. Each declared parameter must be supplied by the argument a query is executed with.
+	Params []QueryParam `json:"params,omitempty" yaml:"params,omitempty"`
+	// Columns declares the columns, in order, returned by the query.
+	Columns []string `json:"columns,omitempty" yaml:"columns,omitempty"`
+	// Timeout, if positive, limits the execution time of the query using the Postgres statement_timeout setting. Query files express the timeout as a duration string such as "5s", of at least 1ms. The timeout is rounded up to whole milliseconds.
+	Timeout time.Duration `json:"-" yaml:"-"`
+	// ReadOnly marks a query that does not modify data, allowing it to run in a read only transaction or on a replica.
+	ReadOnly bool `json:"readOnly,omitempty" yaml:"readOnly,omitempty"`
+	// Tags holds arbitrary labels used to categorize the query.
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// MinSchemaVersion, if positive, is the earliest schema migration version the query can run against, such as the version of the migration adding a column the query references.
+	MinSchemaVersion int64 `json:"minSchemaVersion,omitempty" yaml:"minSchemaVersion,omitempty"`
+	// Source records the file and line the query was loaded from.
+	Source QuerySource `json:"-" yaml:"-"`
+}
+
+// QueryParam declares a named query parameter along with its SQL type.
+type QueryParam struct {
+	Name string `json:"name" yaml:"name"`
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+}
+
+// QuerySource identifies the location of a named query definition.
+type QuerySource struct {
+	File string
+	Line int
+	// QueryLine is the line on which the query text begins, or zero if the lines of the query text do not correspond to lines of the file, as with a JSON string spanning several lines.
+	QueryLine int
+	// ParamsLine is the line on which the query parameters are declared, or zero if the query declares no parameters.
+	ParamsLine int
+}
+
+// String returns the source in file:line form.
+func (s QuerySource) String() string {
+	return fmt.Sprintf("%v:%d", s.File, s.Line)
 }
 
 // QueryMap holds the entire structure representing the unmarshalled set of names queries.
@@ -37,20 +82,56 @@ func (q QueryMap) Q(name string) string {
 	panic(fmt.Sprintf("Could not find a query for name: %v", name))
 }
 
-// LoadNamedQueries loads named queries from explicit file locations, returning an error if a file could not be loaded or parsed as JSON. The JSON format is simply { "queryName", { "query" : "SELECT * FROM...", "description": "A select statement" }. If two queries have the same name either in the same file, or in disparate files, the last query loaded wins, overwriting the previously loaded query.
+// QueryLoadOptions controls how named query files are located and how duplicate query names are resolved.
+type QueryLoadOptions struct {
+	// FS, if set, causes file locations to be treated as glob patterns resolved within this file system rather than as OS file paths.
+	FS fs.FS
+	// Strict rejects a query name that is defined more than once, either within a single file or across files, with a DuplicateQueryError. Strict mode also rejects query objects containing unknown metadata fields.
+	Strict bool
+	// Override permits a query in a later file to replace a query of the same name loaded from an earlier file, so that environment specific files can be layered over a base file. In strict mode, duplicates within a single file remain an error. Without strict mode the last query loaded always wins.
+	Override bool
+	// Dialect selects the variant loaded for queries defined with dialect specific bodies, such as "postgres" or "sqlite". Queries without a variant for the dialect fall back to their "default" variant. If empty, the default variant is loaded.
+	Dialect string
+	// NamespaceFromFileName qualifies the queries of a file that does not declare a namespace with a namespace derived from its file name, up to the first period. For example, the query FindByID in users.json is loaded as users.FindByID.
+	NamespaceFromFileName bool
+}
+
+// DefaultDialect names the variant of a query used when no variant matches the selected dialect.
+const DefaultDialect = "default"
+
+// DuplicateQueryError is returned by a strict load when a query name is defined more than once.
+type DuplicateQueryError struct {
+	Name      string
+	Previous  QuerySource
+	Duplicate QuerySource
+}
+
+// Error returns a message naming the query and both of its definitions.
+func (e *DuplicateQueryError) Error() string {
+	return fmt.Sprintf("duplicate query %v defined at %v and %v", e.Name, e.Previous, e.Duplicate)
+}
+
+// LoadNamedQueries loads named queries from explicit file locations, returning an error if a file could not be loaded or parsed. The file format is chosen by extension: .sql files are parsed as annotated SQL (see parseSQLQueries), .yaml and .yml files are parsed as YAML using the same schema as JSON, all other files are parsed as JSON. The JSON format is simply { "queryName", { "query" : "SELECT * FROM...", "description": "A select statement" }. A query may instead be given as an object mapping dialect names to dialect specific bodies, for example { "postgres": "...", "sqlite": "...", "default": "..." }, see QueryLoadOptions.Dialect. If two queries have the same name either in the same file, or in disparate files, the last query loaded wins, overwriting the previously loaded query. Use LoadNamedQueriesWithOptions to reject duplicates.
 func LoadNamedQueries(fileLocations ...string) (QueryMap, error) {
-	queryMap := make(QueryMap)
-	for _, location := range fileLocations {
-		bytes, err := ioutil.ReadFile(location)
-		if err != nil {
-			return nil, err
-		}
-		err = json.Unmarshal(bytes, &queryMap)
-		if err != nil {
-			return nil, err
-		}
+	return LoadNamedQueriesWithOptions(QueryLoadOptions{}, fileLocations...)
+}
+
+// LoadNamedQueriesFS loads named queries from the files within fsys matching the given glob patterns, returning an error if a pattern is malformed, matches no files, or if a matched file could not be loaded or parsed. Patterns follow the syntax of fs.Glob, making this function suitable for query files compiled in with go:embed. Matched files are loaded in pattern order and, within a pattern, in lexical order. File formats and duplicate query names are handled in the same manner as LoadNamedQueries.
+func LoadNamedQueriesFS(fsys fs.FS, patterns ...string) (QueryMap, error) {
+	return LoadNamedQueriesWithOptions(QueryLoadOptions{FS: fsys}, patterns...)
+}
+
+// LoadNamedQueriesWithOptions loads named queries from the given file locations as configured by opts. File formats are handled in the same manner as LoadNamedQueries. In strict mode, a duplicate query name results in a DuplicateQueryError naming the file and line of both definitions.
+//
+// A query file may declare a namespace, using a "$namespace" key in JSON and YAML files or a "-- namespace:" comment in SQL files, in which case each of its queries is keyed by its fully qualified name, namespace.name. A file may also include other files, using a "$include" key or "-- include:" comment, with paths relative to the including file. Included files are loaded before the queries of the including file, each file is loaded at most once, and include cycles are reported as errors.
+//
+// Files may also define named SQL fragments, using a "$fragments" key or a "-- fragment:" comment, which are referenced from queries and other fragments as {{fragment "name"}}. Fragments are namespaced in the same manner as queries, and a reference is resolved within the namespace of the referencing file before being resolved as a fully qualified name. References are expanded once every file is loaded, so a fragment may be defined in any loaded file. An undefined fragment or a cycle between fragments is an error.
+func LoadNamedQueriesWithOptions(opts QueryLoadOptions, fileLocations ...string) (QueryMap, error) {
+	loader, err := loadNamedQueries(opts, fileLocations)
+	if err != nil {
+		return nil, err
 	}
-	return queryMap, nil
+	return loader.queries, nil
 }
 
 // MustLoadNamedQueries calls LoadNamedQueries and  panics if an error occurs while loading the queries.
@@ -61,3 +142,214 @@ func MustLoadNamedQueries(fileLocations ...string) QueryMap {
 	}
 	return queryMap
 }
+
+// MustLoadNamedQueriesFS calls LoadNamedQueriesFS and panics if an error occurs while loading the queries.
+func MustLoadNamedQueriesFS(fsys fs.FS, patterns ...string) QueryMap {
+	queryMap, err := LoadNamedQueriesFS(fsys, patterns...)
+	if err != nil {
+		panic(fmt.Sprintf("Error loading named queries: %v", err))
+	}
+	return queryMap
+}
+
+// MustLoadNamedQueriesWithOptions calls LoadNamedQueriesWithOptions and panics if an error occurs while loading the queries.
+func MustLoadNamedQueriesWithOptions(opts QueryLoadOptions, fileLocations ...string) QueryMap {
+	queryMap, err := LoadNamedQueriesWithOptions(opts, fileLocations...)
+	if err != nil {
+		panic(fmt.Sprintf("Error loading named queries: %v", err))
+	}
+	return queryMap
+}
+
+// queryLoader accumulates queries across the files of a single load.
+type queryLoader struct {
+	options QueryLoadOptions
+	queries QueryMap
+	// files holds every file read, or attempted to be read, in load order
+	files []string
+	// loaded holds every file that has been completely loaded
+	loaded map[string]bool
+	// loading holds the chain of files currently being loaded, used to detect include cycles
+	loading []string
+	// fragments holds every fragment, keyed by its fully qualified name
+	fragments map[string]loadedFragment
+	// namespaces holds the namespace of every query, keyed by its fully qualified name
+	namespaces map[string]string
+}
+
+// loadNamedQueries loads the given file locations, returning the loader so that callers can inspect which files were loaded. The loader is returned even if the load fails, in which case its files include the file that failed.
+func loadNamedQueries(opts QueryLoadOptions, fileLocations []string) (*queryLoader, error) {
+	loader := &queryLoader{
+		options:    opts,
+		queries:    make(QueryMap),
+		loaded:     make(map[string]bool),
+		fragments:  make(map[string]loadedFragment),
+		namespaces: make(map[string]string),
+	}
+	for _, location := range fileLocations {
+		files, err := loader.resolve(location)
+		if err != nil {
+			return loader, err
+		}
+		for _, file := range files {
+			if err := loader.loadFile(file); err != nil {
+				return loader, err
+			}
+		}
+	}
+	if err := loader.expandFragments(); err != nil {
+		return loader, err
+	}
+	return loader, nil
+}
+
+// resolve expands a location into the files to load. OS paths are returned as is, while locations within a file system are expanded as glob patterns that must match at least one file.
+func (l *queryLoader) resolve(location string) ([]string, error) {
+	if l.options.FS == nil {
+		return []string{location}, nil
+	}
+	matches, err := fs.Glob(l.options.FS, location)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no query files match pattern: %v", location)
+	}
+	return matches, nil
+}
+
+// readFile reads a file from the configured file system, or from the OS if no file system is configured.
+func (l *queryLoader) readFile(file string) ([]byte, error) {
+	if l.options.FS == nil {
+		return ioutil.ReadFile(file)
+	}
+	return fs.ReadFile(l.options.FS, file)
+}
+
+// stat returns file information from the configured file system, or from the OS if no file system is configured.
+func (l *queryLoader) stat(file string) (fs.FileInfo, error) {
+	if l.options.FS == nil {
+		return os.Stat(file)
+	}
+	return fs.Stat(l.options.FS, file)
+}
+
+// includePath resolves an included path relative to the directory of the including file.
+func (l *queryLoader) includePath(file, include string) string {
+	if l.options.FS == nil {
+		if filepath.IsAbs(include) {
+			return include
+		}
+		return filepath.Join(filepath.Dir(file), include)
+	}
+	return path.Join(path.Dir(file), include)
+}
+
+// loadFile reads and parses a single file, loading its includes before adding its queries to the loader. Files that have already been loaded are skipped.
+func (l *queryLoader) loadFile(file string) error {
+	if l.loaded[file] {
+		return nil
+	}
+	l.files = append(l.files, file)
+	data, err := l.readFile(file)
+	if err != nil {
+		return err
+	}
+	parsed, err := parseQueryFile(file, data)
+	if err != nil {
+		return err
+	}
+	l.loading = append(l.loading, file)
+	for _, include := range parsed.includes {
+		target := l.includePath(file, include.path)
+		for _, loading := range l.loading {
+			if loading == target {
+				return fmt.Errorf("%v:%d: include cycle: %v -> %v", file, include.line, strings.Join(l.loading, " -> "), target)
+			}
+		}
+		if err := l.loadFile(target); err != nil {
+			return fmt.Errorf("%v:%d: %w", file, include.line, err)
+		}
+	}
+	l.loading = l.loading[:len(l.loading)-1]
+	l.loaded[file] = true
+	namespace := parsed.namespace
+	if namespace == "" && l.options.NamespaceFromFileName {
+		namespace = fileNamespace(file)
+	}
+	for _, fragment := range parsed.fragments {
+		if err := l.addFragment(file, namespace, fragment); err != nil {
+			return err
+		}
+	}
+	for _, entry := range parsed.entries {
+		if err := l.add(file, namespace, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add adds a parsed query under its fully qualified name, enforcing the duplicate rules of the load options.
+func (l *queryLoader) add(file, namespace string, entry queryEntry) error {
+	name := qualifyName(namespace, entry.name)
+	value := entry.value
+	value.Source = QuerySource{File: file, Line: entry.line, QueryLine: entry.queryLine, ParamsLine: entry.paramsLine}
+	if l.options.Strict && len(entry.unknownFields) > 0 {
+		return fmt.Errorf("%v: query %v: unknown metadata: %v", value.Source, name, strings.Join(entry.unknownFields, ", "))
+	}
+	if len(value.Variants) > 0 {
+		query, err := l.selectVariant(value.Variants)
+		if err != nil {
+			return fmt.Errorf("%v: query %v: %w", value.Source, name, err)
+		}
+		value.Query = query
+		// variants are not attributed to lines
+		value.Source.QueryLine = 0
+	}
+	value.RawQuery = value.Query
+	if previous, exists := l.queries[name]; exists && l.options.Strict {
+		if !l.options.Override || previous.Source.File == file {
+			return &DuplicateQueryError{
+				Name:      name,
+				Previous:  previous.Source,
+				Duplicate: value.Source,
+			}
+		}
+	}
+	l.queries[name] = value
+	l.namespaces[name] = namespace
+	return nil
+}
+
+// selectVariant returns the variant for the configured dialect, falling back to the default variant.
+func (l *queryLoader) selectVariant(variants map[string]string) (string, error) {
+	dialect := strings.ToLower(l.options.Dialect)
+	if query, ok := variants[dialect]; ok && dialect != "" {
+		return query, nil
+	}
+	if query, ok := variants[DefaultDialect]; ok {
+		return query, nil
+	}
+	if dialect == "" {
+		return "", errors.New("no dialect selected and no default variant")
+	}
+	return "", fmt.Errorf("no variant for dialect %v and no default variant", dialect)
+}
+
+// qualifyName prefixes a query name with a namespace, if the namespace is non-empty.
+func qualifyName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// fileNamespace derives a namespace from the base name of a file, up to the first period.
+func fileNamespace(file string) string {
+	base := path.Base(filepath.ToSlash(file))
+	if idx := strings.Index(base, "."); idx > 0 {
+		return base[:idx]
+	}
+	return base
+}
@@ -15,7 +15,10 @@
 package dbx
 
 import (
+	"embed"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -51,3 +54,215 @@ func TestMustLoadNamedQueries(t *testing.T) {
 		MustLoadNamedQueries("abc")
 	})
 }
+
+//go:embed db/queries
+var testQueriesFS embed.FS
+
+func TestLoadNamedQueriesFS(t *testing.T) {
+	// when
+	queryMap, err := LoadNamedQueriesFS(testQueriesFS, "db/queries/test_*.json")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(queryMap))
+	assert.Equal(t, "query1", queryMap.Q("Query1"))
+	assert.Equal(t, "duplicate", queryMap.Q("Query2"))
+}
+
+func TestLoadNamedQueriesFSGlobOrder(t *testing.T) {
+	// given
+	fsys := fstest.MapFS{
+		"queries/a.json": {Data: []byte(`{"QueryA": {"query": "a"}, "Shared": {"query": "from a"}}`)},
+		"queries/b.json": {Data: []byte(`{"QueryB": {"query": "b"}, "Shared": {"query": "from b"}}`)},
+		"other.txt":      {Data: []byte("not a query file")},
+	}
+
+	// when
+	queryMap, err := LoadNamedQueriesFS(fsys, "queries/*.json")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(queryMap))
+	assert.Equal(t, "a", queryMap.Q("QueryA"))
+	assert.Equal(t, "b", queryMap.Q("QueryB"))
+	assert.Equal(t, "from b", queryMap.Q("Shared"))
+}
+
+func TestLoadNamedQueriesFSNoMatch(t *testing.T) {
+	_, err := LoadNamedQueriesFS(testQueriesFS, "db/queries/*.txt")
+
+	assert.Error(t, err)
+}
+
+func TestLoadNamedQueriesFSBadPattern(t *testing.T) {
+	_, err := LoadNamedQueriesFS(testQueriesFS, "db/queries/[")
+
+	assert.Error(t, err)
+}
+
+func TestMustLoadNamedQueriesFS(t *testing.T) {
+	assert.Panics(t, func() {
+		MustLoadNamedQueriesFS(testQueriesFS, "abc")
+	})
+}
+
+func TestLoadNamedQueriesRecordsSource(t *testing.T) {
+	// when
+	queryMap, err := LoadNamedQueries("db/queries/test_queries.json")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, QuerySource{File: "db/queries/test_queries.json", Line: 2, QueryLine: 3}, queryMap["Query1"].Source)
+	assert.Equal(t, QuerySource{File: "db/queries/test_queries.json", Line: 10, QueryLine: 11}, queryMap["Query2"].Source)
+}
+
+func TestStrictLoadRejectsDuplicateInFile(t *testing.T) {
+	// when
+	_, err := LoadNamedQueriesWithOptions(QueryLoadOptions{Strict: true, Override: true}, "db/queries/test_queries.json")
+
+	// then
+	assert.EqualError(t, err, "duplicate query Query2 defined at db/queries/test_queries.json:6 and db/queries/test_queries.json:10")
+	dupErr, ok := err.(*DuplicateQueryError)
+	assert.True(t, ok)
+	assert.Equal(t, "Query2", dupErr.Name)
+}
+
+func TestStrictLoadAcrossFiles(t *testing.T) {
+	// given
+	fsys := fstest.MapFS{
+		"base.json":    {Data: []byte("{\n\"QueryA\": {\"query\": \"a\"},\n\"Shared\": {\"query\": \"base\"}\n}")},
+		"staging.yaml": {Data: []byte("Shared:\n  query: staging\n")},
+	}
+
+	// when
+	_, strictErr := LoadNamedQueriesWithOptions(QueryLoadOptions{FS: fsys, Strict: true}, "base.json", "staging.yaml")
+	queryMap, overrideErr := LoadNamedQueriesWithOptions(QueryLoadOptions{FS: fsys, Strict: true, Override: true}, "base.json", "staging.yaml")
+
+	// then
+	assert.EqualError(t, strictErr, "duplicate query Shared defined at base.json:3 and staging.yaml:1")
+	assert.NoError(t, overrideErr)
+	assert.Equal(t, "a", queryMap.Q("QueryA"))
+	assert.Equal(t, "staging", queryMap.Q("Shared"))
+	assert.Equal(t, QuerySource{File: "staging.yaml", Line: 1, QueryLine: 2}, queryMap["Shared"].Source)
+}
+
+func TestMustLoadNamedQueriesWithOptions(t *testing.T) {
+	assert.Panics(t, func() {
+		MustLoadNamedQueriesWithOptions(QueryLoadOptions{Strict: true}, "db/queries/test_queries.json")
+	})
+}
+
+func TestLoadNamespacedQueries(t *testing.T) {
+	// when
+	queryMap, err := LoadNamedQueriesWithOptions(QueryLoadOptions{Strict: true, NamespaceFromFileName: true}, "db/queries/namespaces/users.json", "db/queries/namespaces/orders.yaml")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(queryMap))
+	assert.Equal(t, "SELECT id FROM users WHERE id = :id", queryMap.Q("users.FindByID"))
+	assert.Equal(t, "SELECT id FROM orders WHERE id = :id", queryMap.Q("billing.FindByID"))
+	assert.Equal(t, "SELECT now()", queryMap.Q("common.Now"))
+	assert.Equal(t, QuerySource{File: "db/queries/namespaces/shared/common.sql", Line: 3, QueryLine: 4}, queryMap["common.Now"].Source)
+}
+
+func TestLoadNamespacedQueriesFS(t *testing.T) {
+	// when
+	queryMap, err := LoadNamedQueriesFS(testQueriesFS, "db/queries/namespaces/*.json")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(queryMap))
+	assert.Equal(t, "SELECT id FROM users WHERE id = :id", queryMap.Q("FindByID"))
+	assert.Equal(t, "SELECT now()", queryMap.Q("common.Now"))
+}
+
+func TestLoadIncludeCycle(t *testing.T) {
+	_, err := LoadNamedQueries("db/queries/cycle/a.json")
+
+	assert.EqualError(t, err, "db/queries/cycle/a.json:2: db/queries/cycle/b.json:2: include cycle: db/queries/cycle/a.json -> db/queries/cycle/b.json -> db/queries/cycle/a.json")
+}
+
+func TestLoadMissingInclude(t *testing.T) {
+	// given
+	fsys := fstest.MapFS{
+		"queries/a.json": {Data: []byte("{\"$include\": \"missing.json\"}")},
+	}
+
+	// when
+	_, err := LoadNamedQueriesFS(fsys, "queries/a.json")
+
+	// then
+	assert.EqualError(t, err, "queries/a.json:1: open queries/missing.json: file does not exist")
+}
+
+func TestLoadDialectVariants(t *testing.T) {
+	// when
+	postgres, err := LoadNamedQueriesWithOptions(QueryLoadOptions{Dialect: "Postgres"}, "db/queries/dialect_queries.json", "db/queries/dialect_queries.sql")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "INSERT INTO test (ColA) VALUES (:cola) ON CONFLICT DO NOTHING", postgres.Q("Upsert"))
+	assert.Equal(t, "SELECT count(*) FROM test", postgres.Q("Count"))
+	assert.Equal(t, "SELECT now()", postgres.Q("Now"))
+	assert.Equal(t, "Returns the current time", postgres["Now"].Description)
+	assert.Equal(t, map[string]string{"postgres": "SELECT now()", "sqlite": "SELECT datetime('now')"}, postgres["Now"].Variants)
+	assert.Equal(t, "SELECT version()", postgres.Q("Version"))
+
+	// when
+	sqlite, err := LoadNamedQueriesWithOptions(QueryLoadOptions{Dialect: "sqlite"}, "db/queries/dialect_queries.json")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "INSERT INTO test (ColA) VALUES (:cola)", sqlite.Q("Upsert"))
+}
+
+func TestLoadDialectVariantMissing(t *testing.T) {
+	// when
+	_, sqliteErr := LoadNamedQueriesWithOptions(QueryLoadOptions{Dialect: "sqlite"}, "db/queries/dialect_queries.sql")
+	_, noDialectErr := LoadNamedQueries("db/queries/dialect_queries.sql")
+
+	// then
+	assert.EqualError(t, sqliteErr, "db/queries/dialect_queries.sql:10: query Version: no variant for dialect sqlite and no default variant")
+	assert.EqualError(t, noDialectErr, "db/queries/dialect_queries.sql:1: query Now: no dialect selected and no default variant")
+}
+
+func TestLoadQueryMetadata(t *testing.T) {
+	// when
+	queryMap, err := LoadNamedQueriesWithOptions(QueryLoadOptions{Strict: true}, "db/queries/metadata_queries.json", "db/queries/metadata_queries.sql")
+
+	// then
+	assert.NoError(t, err)
+	findTest := queryMap["FindTest"]
+	assert.Equal(t, []QueryParam{{Name: "cola", Type: "bigint"}}, findTest.Params)
+	assert.Equal(t, []string{"cola"}, findTest.Columns)
+	assert.Equal(t, 5*time.Second, findTest.Timeout)
+	assert.True(t, findTest.ReadOnly)
+	assert.Equal(t, []string{"test", "lookup"}, findTest.Tags)
+	insertTest := queryMap["InsertTest"]
+	assert.Equal(t, "Inserts a row into the test table", insertTest.Description)
+	assert.Equal(t, []QueryParam{{Name: "cola", Type: "bigint"}}, insertTest.Params)
+	assert.Equal(t, 500*time.Millisecond, insertTest.Timeout)
+	assert.False(t, insertTest.ReadOnly)
+	assert.Equal(t, []string{"test", "write"}, insertTest.Tags)
+	assert.True(t, queryMap["FindWrongColumns"].ReadOnly)
+}
+
+func TestStrictLoadRejectsUnknownMetadata(t *testing.T) {
+	// given
+	fsys := fstest.MapFS{
+		"q.json": {Data: []byte("{\n\"A\": {\"query\": \"a\", \"cache\": true, \"readonly\": true}\n}")},
+		"q.yaml": {Data: []byte("B:\n  query: b\n  timeot: 5s\n")},
+	}
+
+	// when
+	queryMap, err := LoadNamedQueriesWithOptions(QueryLoadOptions{FS: fsys}, "q.json")
+	_, jsonErr := LoadNamedQueriesWithOptions(QueryLoadOptions{FS: fsys, Strict: true}, "q.json")
+	_, yamlErr := LoadNamedQueriesWithOptions(QueryLoadOptions{FS: fsys, Strict: true}, "q.yaml")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "a", queryMap.Q("A"))
+	assert.False(t, queryMap["A"].ReadOnly)
+	assert.EqualError(t, jsonErr, "q.json:2: query A: unknown metadata: cache, readonly")
+	assert.EqualError(t, yamlErr, "q.yaml:1: query B: unknown metadata: timeot")
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// argMapper maps named parameters to struct fields in the same manner as sqlx.
+var argMapper = reflectx.NewMapperFunc("db", sqlx.NameMapper)
+
+// CheckArg verifies that arg supplies every declared parameter of the query. arg may be a map[string]interface{}, or a struct, or pointer to a struct, whose fields are mapped using "db" tags as sqlx does. A nil arg supplies no parameters. Returns an error listing any missing parameters.
+func (v QueryValue) CheckArg(arg interface{}) error {
+	if len(v.Params) == 0 {
+		return nil
+	}
+	supplied, err := argSupplies(arg)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, param := range v.Params {
+		if !supplied(param.Name) {
+			missing = append(missing, param.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("argument is missing declared parameters: %v", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// CheckColumns verifies that the columns returned by the query match its declared columns, in order. Returns nil if no columns are declared.
+func (v QueryValue) CheckColumns(columns []string) error {
+	if len(v.Columns) == 0 {
+		return nil
+	}
+	if !reflect.DeepEqual(v.Columns, columns) {
+		return fmt.Errorf("expected columns %v but the query returned %v", strings.Join(v.Columns, ", "), strings.Join(columns, ", "))
+	}
+	return nil
+}
+
+// statementTimeout returns the SQL statement that applies the query timeout to the current transaction. The timeout is rounded up to a whole number of milliseconds, so that a timeout below a millisecond does not become zero, which disables the timeout.
+func (v QueryValue) statementTimeout() string {
+	return fmt.Sprintf("SET LOCAL statement_timeout = %d", (v.Timeout+time.Millisecond-1)/time.Millisecond)
+}
+
+// argSupplies returns a function reporting whether arg supplies a named parameter.
+func argSupplies(arg interface{}) (func(name string) bool, error) {
+	if arg == nil {
+		return func(string) bool { return false }, nil
+	}
+	if m, ok := arg.(map[string]interface{}); ok {
+		return func(name string) bool {
+			_, exists := m[name]
+			return exists
+		}, nil
+	}
+	t := reflectx.Deref(reflect.TypeOf(arg))
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unsupported argument type %v, expected a struct or map[string]interface{}", t)
+	}
+	fields := argMapper.TypeMap(t)
+	return func(name string) bool {
+		return fields.GetByPath(name) != nil
+	}, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type metadataArg struct {
+	ColA  int64 `db:"cola"`
+	Name  string
+	Inner struct {
+		ID int64 `db:"id"`
+	} `db:"inner"`
+}
+
+func TestCheckArg(t *testing.T) {
+	// given
+	value := QueryValue{Params: []QueryParam{{Name: "cola", Type: "bigint"}, {Name: "name"}, {Name: "inner.id"}}}
+
+	// then
+	assert.NoError(t, value.CheckArg(metadataArg{}))
+	assert.NoError(t, value.CheckArg(&metadataArg{}))
+	assert.NoError(t, value.CheckArg(map[string]interface{}{"cola": 1, "name": "a", "inner.id": 2}))
+	assert.EqualError(t, value.CheckArg(map[string]interface{}{"cola": 1}), "argument is missing declared parameters: name, inner.id")
+	assert.EqualError(t, value.CheckArg(nil), "argument is missing declared parameters: cola, name, inner.id")
+	assert.EqualError(t, value.CheckArg(1), "unsupported argument type int, expected a struct or map[string]interface{}")
+	assert.NoError(t, QueryValue{}.CheckArg(1))
+}
+
+func TestCheckColumns(t *testing.T) {
+	// given
+	value := QueryValue{Columns: []string{"cola", "colb"}}
+
+	// then
+	assert.NoError(t, value.CheckColumns([]string{"cola", "colb"}))
+	assert.EqualError(t, value.CheckColumns([]string{"colb", "cola"}), "expected columns cola, colb but the query returned colb, cola")
+	assert.NoError(t, QueryValue{}.CheckColumns([]string{"cola"}))
+}
+
+func TestStatementTimeout(t *testing.T) {
+	cases := map[time.Duration]string{
+		5 * time.Second:         "SET LOCAL statement_timeout = 5000",
+		1500 * time.Microsecond: "SET LOCAL statement_timeout = 2",
+		500 * time.Microsecond:  "SET LOCAL statement_timeout = 1",
+		time.Millisecond:        "SET LOCAL statement_timeout = 1",
+	}
+	for timeout, expected := range cases {
+		assert.Equal(t, expected, QueryValue{Timeout: timeout}.statementTimeout())
+	}
+}
@@ -0,0 +1,405 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// directivePrefix marks a key in a JSON or YAML query file as a directive rather than a query name.
+	directivePrefix    = "$"
+	namespaceDirective = "namespace"
+	includeDirective   = "include"
+	fragmentsDirective = "fragments"
+)
+
+// queryEntry is a single named query parsed from a file, along with the line on which it is defined.
+type queryEntry struct {
+	name  string
+	value QueryValue
+	line  int
+	// queryLine is the line on which the query text begins, or zero if its lines do not correspond to lines of the file
+	queryLine int
+	// paramsLine is the line on which the parameters are declared, or zero if there are none
+	paramsLine int
+	// unknownFields lists any keys of the query object that are not recognized
+	unknownFields []string
+}
+
+// queryInclude is a file included by another query file, along with the line of the include directive.
+type queryInclude struct {
+	path string
+	line int
+}
+
+// queryFragment is a named, reusable piece of SQL parsed from a file, along with the line on which it is defined.
+type queryFragment struct {
+	name string
+	text string
+	line int
+}
+
+// queryFile holds the parsed contents of a query file.
+type queryFile struct {
+	// namespace qualifies the names of every query and fragment in the file, if set
+	namespace string
+	// includes lists the files to load before the queries of this file
+	includes []queryInclude
+	// entries holds the queries in the order they are defined
+	entries []queryEntry
+	// fragments holds the fragments in the order they are defined
+	fragments []queryFragment
+}
+
+// addDirective applies a directive found on the given line of the file. A namespace takes a single value and may only be declared once, while include accepts any number of file paths.
+func (f *queryFile) addDirective(directive string, values []string, line int) error {
+	switch directive {
+	case namespaceDirective:
+		if len(values) != 1 || strings.TrimSpace(values[0]) == "" {
+			return fmt.Errorf("line %d: %v requires a single non-empty value", line, directive)
+		}
+		if f.namespace != "" {
+			return fmt.Errorf("line %d: %v declared more than once", line, directive)
+		}
+		f.namespace = values[0]
+	case includeDirective:
+		for _, value := range values {
+			if strings.TrimSpace(value) == "" {
+				return fmt.Errorf("line %d: %v requires a non-empty file path", line, directive)
+			}
+			f.includes = append(f.includes, queryInclude{path: value, line: line})
+		}
+	default:
+		return fmt.Errorf("line %d: unknown directive: %v", line, directive)
+	}
+	return nil
+}
+
+// queryDocument is the schema of a query object within a JSON or YAML query file.
+type queryDocument struct {
+	Query            queryBody    `json:"query" yaml:"query"`
+	Description      string       `json:"description" yaml:"description"`
+	Params           []QueryParam `json:"params" yaml:"params"`
+	Columns          []string     `json:"columns" yaml:"columns"`
+	Timeout          string       `json:"timeout" yaml:"timeout"`
+	ReadOnly         bool         `json:"readOnly" yaml:"readOnly"`
+	Tags             []string     `json:"tags" yaml:"tags"`
+	MinSchemaVersion int64        `json:"minSchemaVersion" yaml:"minSchemaVersion"`
+}
+
+// queryDocumentFields maps the field names of a query object to the index of the field within queryDocument. Field names are matched exactly, in the same manner as YAML, rather than case insensitively as json.Unmarshal does, so that strict and non strict loading agree on which keys are metadata.
+var queryDocumentFields = documentFields(reflect.TypeOf(queryDocument{}), "json")
+
+// documentFields returns the names given to the fields of a struct type by the given tag, mapped to the index of each field.
+func documentFields(t reflect.Type, tag string) map[string]int {
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		fields[strings.Split(t.Field(i).Tag.Get(tag), ",")[0]] = i
+	}
+	return fields
+}
+
+// unknownFields returns the keys that are not query object fields, in the order given.
+func unknownFields(keys []string) []string {
+	var unknown []string
+	for _, key := range keys {
+		if _, known := queryDocumentFields[key]; !known {
+			unknown = append(unknown, key)
+		}
+	}
+	return unknown
+}
+
+// value converts the document into a QueryValue. Returns an error if the timeout is not a valid duration.
+func (d *queryDocument) value() (QueryValue, error) {
+	value := QueryValue{
+		Query:            d.Query.text,
+		Description:      d.Description,
+		Variants:         d.Query.variants,
+		Params:           d.Params,
+		Columns:          d.Columns,
+		ReadOnly:         d.ReadOnly,
+		Tags:             d.Tags,
+		MinSchemaVersion: d.MinSchemaVersion,
+	}
+	if d.Timeout != "" {
+		timeout, err := parseQueryTimeout(d.Timeout)
+		if err != nil {
+			return QueryValue{}, err
+		}
+		value.Timeout = timeout
+	}
+	return value, nil
+}
+
+// parseQueryTimeout parses a timeout expressed as a Go duration, such as "500ms" or "5s". The timeout must be at least a millisecond, the resolution of the Postgres statement_timeout setting, as a timeout of zero disables it.
+func parseQueryTimeout(s string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(s)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout: %v", s)
+	}
+	if timeout < time.Millisecond {
+		return 0, fmt.Errorf("invalid timeout: %v is less than 1ms", s)
+	}
+	return timeout, nil
+}
+
+// queryBody holds a query given either as a string, or as an object mapping dialect names to dialect specific queries.
+type queryBody struct {
+	text     string
+	variants map[string]string
+}
+
+// UnmarshalJSON decodes a query string or an object of dialect variants.
+func (b *queryBody) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &b.text); err == nil {
+		return nil
+	}
+	var variants map[string]string
+	if err := json.Unmarshal(data, &variants); err != nil {
+		return errors.New("query must be a string or an object mapping dialects to queries")
+	}
+	return b.setVariants(variants)
+}
+
+// UnmarshalYAML decodes a query string or a mapping of dialect variants.
+func (b *queryBody) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		b.text = node.Value
+		return nil
+	}
+	var variants map[string]string
+	if err := node.Decode(&variants); err != nil {
+		return fmt.Errorf("line %d: query must be a string or a mapping of dialects to queries", node.Line)
+	}
+	return b.setVariants(variants)
+}
+
+// setVariants stores the variants keyed by lower case dialect name.
+func (b *queryBody) setVariants(variants map[string]string) error {
+	if len(variants) == 0 {
+		return errors.New("query variants must name at least one dialect")
+	}
+	b.variants = make(map[string]string, len(variants))
+	for dialect, query := range variants {
+		b.variants[strings.ToLower(dialect)] = query
+	}
+	return nil
+}
+
+// queryParser parses the contents of a query file.
+type queryParser func(data []byte) (*queryFile, error)
+
+// queryParsers maps a lower case file extension to the parser responsible for files of that type. Files with an unregistered extension are parsed as JSON.
+var queryParsers = map[string]queryParser{
+	".json": parseJSONQueries,
+	".sql":  parseSQLQueries,
+	".yaml": parseYAMLQueries,
+	".yml":  parseYAMLQueries,
+}
+
+// parseQueryFile selects a parser based on the file extension of location and parses data. Parse errors are prefixed with the file location.
+func parseQueryFile(location string, data []byte) (*queryFile, error) {
+	parser, ok := queryParsers[strings.ToLower(path.Ext(location))]
+	if !ok {
+		parser = parseJSONQueries
+	}
+	file, err := parser(data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", location, err)
+	}
+	return file, nil
+}
+
+// parseJSONQueries parses a JSON query file of the form { "queryName": { "query": "...", "description": "..." } }. Keys beginning with $ are directives: "$namespace" takes a string, "$include" takes a file path or an array of file paths and "$fragments" takes an object mapping fragment names to SQL. The file is decoded token by token so that duplicate names within the file are preserved in order and each query can be attributed to a line. Syntax and type errors report the line on which they occur.
+func parseJSONQueries(data []byte) (*queryFile, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	file, err := decodeJSONQueries(decoder, data)
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			return nil, fmt.Errorf("line %d: %w", lineAt(data, syntaxErr.Offset), err)
+		case errors.As(err, &typeErr):
+			return nil, fmt.Errorf("line %d: %w", lineAt(data, typeErr.Offset), err)
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			return nil, fmt.Errorf("line %d: %w", lineAt(data, decoder.InputOffset()), err)
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+func decodeJSONQueries(decoder *json.Decoder, data []byte) (*queryFile, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("line %d: expected an object of query names to queries", lineAt(data, decoder.InputOffset()))
+	}
+	file := &queryFile{entries: make([]queryEntry, 0)}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		// object keys are always decoded as strings
+		name := token.(string)
+		line := lineAt(data, decoder.InputOffset())
+		if name == directivePrefix+fragmentsDirective {
+			var fragments map[string]string
+			if err := decoder.Decode(&fragments); err != nil {
+				return nil, err
+			}
+			// fragments are sorted by name so that parsing is deterministic
+			names := make([]string, 0, len(fragments))
+			for fragmentName := range fragments {
+				names = append(names, fragmentName)
+			}
+			sort.Strings(names)
+			for _, fragmentName := range names {
+				file.fragments = append(file.fragments, queryFragment{name: fragmentName, text: fragments[fragmentName], line: line})
+			}
+			continue
+		}
+		if strings.HasPrefix(name, directivePrefix) {
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); err != nil {
+				return nil, err
+			}
+			values, err := decodeJSONDirective(raw)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v must be a string or an array of strings", line, name)
+			}
+			if err := file.addDirective(strings.TrimPrefix(name, directivePrefix), values, line); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		entry, err := decodeJSONQuery(decoder, data, name, line)
+		if err != nil {
+			return nil, err
+		}
+		file.entries = append(file.entries, entry)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// decodeJSONQuery decodes a single query object. Each key is decoded into the query document field with exactly the same name, and any unknown keys are recorded on the entry. Type errors are reported relative to the start of data so that their line can be determined.
+func decodeJSONQuery(decoder *json.Decoder, data []byte, name string, line int) (queryEntry, error) {
+	var raw json.RawMessage
+	if err := decoder.Decode(&raw); err != nil {
+		return queryEntry{}, err
+	}
+	start := decoder.InputOffset() - int64(len(raw))
+	if raw[0] != '{' {
+		return queryEntry{}, fmt.Errorf("line %d: expected a query object for %v", line, name)
+	}
+	var document queryDocument
+	documentValue := reflect.ValueOf(&document).Elem()
+	object := json.NewDecoder(bytes.NewReader(raw))
+	// the object has already been validated by decoder, so only its opening delimiter is skipped here
+	object.Token()
+	var fields []string
+	var queryLine, paramsLine int
+	for object.More() {
+		token, err := object.Token()
+		if err != nil {
+			return queryEntry{}, err
+		}
+		key := token.(string)
+		var field json.RawMessage
+		if err := object.Decode(&field); err != nil {
+			return queryEntry{}, err
+		}
+		fields = append(fields, key)
+		index, known := queryDocumentFields[key]
+		if !known {
+			continue
+		}
+		fieldStart := start + object.InputOffset() - int64(len(field))
+		switch key {
+		case "query":
+			queryLine = lineAt(data, fieldStart)
+		case "params":
+			paramsLine = lineAt(data, fieldStart)
+		}
+		if err := json.Unmarshal(field, documentValue.Field(index).Addr().Interface()); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				typeErr.Offset += fieldStart
+				typeErr.Struct = "queryDocument"
+				if typeErr.Field == "" {
+					typeErr.Field = key
+				} else {
+					typeErr.Field = key + "." + typeErr.Field
+				}
+				return queryEntry{}, err
+			}
+			return queryEntry{}, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	value, err := document.value()
+	if err != nil {
+		return queryEntry{}, fmt.Errorf("line %d: %w", line, err)
+	}
+	if strings.Contains(value.Query, "\n") {
+		// the lines of a JSON string are escaped onto a single line of the file
+		queryLine = 0
+	}
+	if len(value.Params) == 0 {
+		paramsLine = 0
+	}
+	sort.Strings(fields)
+	return queryEntry{name: name, value: value, line: line, queryLine: queryLine, paramsLine: paramsLine, unknownFields: unknownFields(fields)}, nil
+}
+
+// decodeJSONDirective decodes a directive value given as either a string or an array of strings.
+func decodeJSONDirective(raw json.RawMessage) ([]string, error) {
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return []string{value}, nil
+	}
+	var values []string
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// lineAt returns the 1 based line number of the given byte offset within data.
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
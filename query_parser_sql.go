@@ -0,0 +1,249 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	sqlCommentPrefix        = "--"
+	sqlNameAttribute        = "name"
+	sqlFragmentAttribute    = "fragment"
+	sqlDescriptionAttribute = "description"
+	sqlDialectAttribute     = "dialect"
+	sqlParamsAttribute      = "params"
+	sqlColumnsAttribute     = "columns"
+	sqlTimeoutAttribute     = "timeout"
+	sqlReadOnlyAttribute    = "readonly"
+	sqlTagsAttribute        = "tags"
+	sqlMinSchemaVersion     = "minschemaversion"
+)
+
+// parseSQLQueries parses an annotated SQL file in the style of yesql. Each query begins with a "-- name: QueryName" comment, optionally followed by one or more "-- description: ..." comments, and continues until the next name comment or the end of the file. Description lines are joined with a single space. A "-- dialect: postgres" header marks the query as a dialect specific variant, and consecutive or separate blocks with the same name and differing dialects are combined into a single query with variants. Query metadata is declared with "-- params: id bigint, name text", "-- columns: id, name", "-- timeout: 5s", "-- readonly: true", "-- tags: a, b" and "-- minSchemaVersion: 20190101120000" headers. Any other comments following the header are kept as part of the query text. A "-- fragment: FragmentName" comment begins a reusable fragment in the same manner as a query, without a description. Before the first query or fragment, "-- namespace: ..." and "-- include: ..." comments are treated as directives, while other comments are ignored. Returns an error, reporting the line number, if SQL appears before the first name comment, a header attribute is unknown, or a query has no SQL.
+func parseSQLQueries(data []byte) (*queryFile, error) {
+	var (
+		file        = &queryFile{}
+		name        string
+		nameLine    int
+		isFragment  bool
+		dialect     string
+		inHeader    bool
+		description []string
+		metadata    QueryValue
+		paramsLine  int
+		body        []string
+		bodyLine    int
+	)
+	flush := func() error {
+		if name == "" {
+			return nil
+		}
+		text := strings.Join(body, "\n")
+		query := strings.TrimSpace(text)
+		// the query begins after any blank lines trimmed from the start of the body
+		queryLine := bodyLine + strings.Count(text[:len(text)-len(strings.TrimLeftFunc(text, unicode.IsSpace))], "\n")
+		if query == "" && isFragment {
+			return fmt.Errorf("line %d: fragment %v has no SQL", nameLine, name)
+		}
+		if query == "" {
+			return fmt.Errorf("line %d: query %v has no SQL", nameLine, name)
+		}
+		if isFragment {
+			file.fragments = append(file.fragments, queryFragment{name: name, text: query, line: nameLine})
+			return nil
+		}
+		metadata.Description = strings.Join(description, " ")
+		if dialect != "" {
+			return addSQLVariant(file, name, dialect, query, metadata, nameLine)
+		}
+		metadata.Query = query
+		file.entries = append(file.entries, queryEntry{name: name, value: metadata, line: nameLine, queryLine: queryLine, paramsLine: paramsLine})
+		return nil
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		lineNumber := i + 1
+		line = strings.TrimRight(line, "\r")
+		key, value, isAttribute := parseSQLAttribute(line)
+		if isAttribute && (key == sqlNameAttribute || key == sqlFragmentAttribute) {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			if value == "" && key == sqlFragmentAttribute {
+				return nil, fmt.Errorf("line %d: empty fragment name", lineNumber)
+			}
+			if value == "" {
+				return nil, fmt.Errorf("line %d: empty query name", lineNumber)
+			}
+			name, nameLine, inHeader, isFragment = value, lineNumber, true, key == sqlFragmentAttribute
+			description, body, dialect, metadata, paramsLine = nil, nil, "", QueryValue{}, 0
+			continue
+		}
+		if inHeader && isAttribute {
+			if isFragment {
+				return nil, fmt.Errorf("line %d: unknown fragment attribute: %v", lineNumber, key)
+			}
+			switch key {
+			case sqlDescriptionAttribute:
+				description = append(description, value)
+			case sqlDialectAttribute:
+				if value == "" || dialect != "" {
+					return nil, fmt.Errorf("line %d: a query requires a single non-empty dialect", lineNumber)
+				}
+				dialect = strings.ToLower(value)
+			default:
+				if err := setSQLMetadata(&metadata, key, value); err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+				}
+				if key == sqlParamsAttribute && paramsLine == 0 {
+					paramsLine = lineNumber
+				}
+			}
+			continue
+		}
+		if name == "" && isAttribute && (key == namespaceDirective || key == includeDirective) {
+			if err := file.addDirective(key, []string{value}, lineNumber); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if name == "" {
+			trimmed := strings.TrimSpace(line)
+			if trimmed != "" && !strings.HasPrefix(trimmed, sqlCommentPrefix) {
+				return nil, fmt.Errorf("line %d: SQL found before the first -- name: comment", lineNumber)
+			}
+			continue
+		}
+		if len(body) == 0 {
+			bodyLine = lineNumber
+		}
+		inHeader = false
+		body = append(body, line)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// addSQLVariant adds a dialect specific variant to the query of the same name previously defined with variants, or adds a new query if there is none. Description and metadata are taken from the first block that declares them.
+func addSQLVariant(file *queryFile, name, dialect, query string, value QueryValue, line int) error {
+	for i := len(file.entries) - 1; i >= 0; i-- {
+		entry := &file.entries[i]
+		if entry.name != name || entry.value.Variants == nil {
+			continue
+		}
+		if _, exists := entry.value.Variants[dialect]; exists {
+			return fmt.Errorf("line %d: query %v already has a %v variant", line, name, dialect)
+		}
+		entry.value.Variants[dialect] = query
+		mergeSQLMetadata(&entry.value, value)
+		return nil
+	}
+	value.Variants = map[string]string{dialect: query}
+	file.entries = append(file.entries, queryEntry{name: name, value: value, line: line})
+	return nil
+}
+
+// mergeSQLMetadata copies the description and metadata of from into any field of to that is not yet set.
+func mergeSQLMetadata(to *QueryValue, from QueryValue) {
+	if to.Description == "" {
+		to.Description = from.Description
+	}
+	if to.Params == nil {
+		to.Params = from.Params
+	}
+	if to.Columns == nil {
+		to.Columns = from.Columns
+	}
+	if to.Timeout == 0 {
+		to.Timeout = from.Timeout
+	}
+	if to.Tags == nil {
+		to.Tags = from.Tags
+	}
+	if to.MinSchemaVersion == 0 {
+		to.MinSchemaVersion = from.MinSchemaVersion
+	}
+	to.ReadOnly = to.ReadOnly || from.ReadOnly
+}
+
+// setSQLMetadata sets the metadata field of the query identified by a header attribute. Returns an error if the attribute is unknown or its value is invalid.
+func setSQLMetadata(value *QueryValue, key, attribute string) error {
+	switch key {
+	case sqlParamsAttribute:
+		for _, param := range splitSQLList(attribute) {
+			fields := strings.Fields(param)
+			value.Params = append(value.Params, QueryParam{Name: fields[0], Type: strings.Join(fields[1:], " ")})
+		}
+	case sqlColumnsAttribute:
+		value.Columns = append(value.Columns, splitSQLList(attribute)...)
+	case sqlTimeoutAttribute:
+		timeout, err := parseQueryTimeout(attribute)
+		if err != nil {
+			return err
+		}
+		value.Timeout = timeout
+	case sqlReadOnlyAttribute:
+		readOnly, err := strconv.ParseBool(attribute)
+		if err != nil {
+			return fmt.Errorf("invalid readonly value: %v", attribute)
+		}
+		value.ReadOnly = readOnly
+	case sqlTagsAttribute:
+		value.Tags = append(value.Tags, splitSQLList(attribute)...)
+	case sqlMinSchemaVersion:
+		version, err := strconv.ParseInt(attribute, 10, 64)
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid minSchemaVersion: %v", attribute)
+		}
+		value.MinSchemaVersion = version
+	default:
+		return fmt.Errorf("unknown query attribute: %v", key)
+	}
+	return nil
+}
+
+// splitSQLList splits a comma separated attribute value, trimming each item and dropping empty items.
+func splitSQLList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseSQLAttribute parses a comment line of the form "-- key: value", returning the lower cased key, the trimmed value and whether the line is an attribute.
+func parseSQLAttribute(line string) (string, string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, sqlCommentPrefix) {
+		return "", "", false
+	}
+	comment := strings.TrimSpace(strings.TrimPrefix(trimmed, sqlCommentPrefix))
+	idx := strings.Index(comment, ":")
+	if idx <= 0 {
+		return "", "", false
+	}
+	key := comment[:idx]
+	if strings.ContainsAny(key, " \t") {
+		return "", "", false
+	}
+	return strings.ToLower(key), strings.TrimSpace(comment[idx+1:]), true
+}
@@ -0,0 +1,188 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJSONQueriesPreservesDuplicates(t *testing.T) {
+	// given
+	data := []byte("{\n  \"A\": {\"query\": \"a\"},\n  \"B\": {\"query\": \"b\"},\n  \"A\": {\"query\": \"c\"}\n}")
+
+	// when
+	file, err := parseJSONQueries(data)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []queryEntry{
+		{name: "A", value: QueryValue{Query: "a"}, line: 2, queryLine: 2},
+		{name: "B", value: QueryValue{Query: "b"}, line: 3, queryLine: 3},
+		{name: "A", value: QueryValue{Query: "c"}, line: 4, queryLine: 4},
+	}, file.entries)
+}
+
+func TestParseJSONQueriesErrors(t *testing.T) {
+	cases := map[string]string{
+		"[]":                                "q.json: line 1: expected an object of query names to queries",
+		"{\n\"A\": {\"description\": 1}\n}": "q.json: line 2: json: cannot unmarshal number into Go struct field queryDocument.description of type string",
+		"{\n\"A\": {\"query\": 1}\n}":       "q.json: line 2: query must be a string or an object mapping dialects to queries",
+		"{\n\"A\": {\"query\": \"a\", \"timeout\": \"-1s\"}\n}":   "q.json: line 2: invalid timeout: -1s",
+		"{\n\"A\": {\"query\": \"a\",\n\"readOnly\": \"yes\"}\n}": "q.json: line 3: json: cannot unmarshal string into Go struct field queryDocument.readOnly of type bool",
+		"{\n\"A\": {\"query\": \"a\"},\n\"B\" 1}":                 "q.json: line 3: invalid character '1' after object key",
+	}
+	for data, expected := range cases {
+		_, err := parseQueryFile("q.json", []byte(data))
+		assert.EqualError(t, err, expected)
+	}
+}
+
+func TestLoadSQLQueries(t *testing.T) {
+	// when
+	queryMap, err := LoadNamedQueries("db/queries/test_queries.sql")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(queryMap))
+
+	value := queryMap["FindTest"]
+	assert.Equal(t, "SELECT ColA\nFROM test\nWHERE ColA = :cola;", value.Query)
+	assert.Equal(t, "Finds a row in the test table by its primary key.", value.Description)
+
+	value = queryMap["InsertTest"]
+	assert.Equal(t, "INSERT INTO test (ColA) VALUES (:cola)", value.Query)
+	assert.Equal(t, "", value.Description)
+}
+
+func TestLoadMixedQueryFiles(t *testing.T) {
+	// when
+	queryMap, err := LoadNamedQueries("db/queries/test_queries.json", "db/queries/test_queries.sql")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(queryMap))
+	assert.Equal(t, "query1", queryMap.Q("Query1"))
+	assert.Equal(t, "INSERT INTO test (ColA) VALUES (:cola)", queryMap.Q("InsertTest"))
+}
+
+func TestParseSQLQueriesKeepsBodyComments(t *testing.T) {
+	// given
+	data := []byte("-- name: Q\n\n-- a comment in the body\nSELECT 1\n-- name: R\r\nSELECT 2\r\n")
+
+	// when
+	file, err := parseSQLQueries(data)
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, file.entries, 2)
+	assert.Equal(t, queryEntry{name: "Q", value: QueryValue{Query: "-- a comment in the body\nSELECT 1"}, line: 1, queryLine: 3}, file.entries[0])
+	assert.Equal(t, queryEntry{name: "R", value: QueryValue{Query: "SELECT 2"}, line: 5, queryLine: 6}, file.entries[1])
+}
+
+func TestParseSQLQueriesErrors(t *testing.T) {
+	cases := map[string]string{
+		"SELECT 1\n-- name: Q\nSELECT 2":              "line 1: SQL found before the first -- name: comment",
+		"-- name: Q\n-- cache: 1s\nSELECT":            "line 2: unknown query attribute: cache",
+		"-- name: Q\n-- timeout: 1\nSELECT":           "line 2: invalid timeout: 1",
+		"-- name: Q\n-- timeout: 500us\nSELECT":       "line 2: invalid timeout: 500us is less than 1ms",
+		"-- name: Q\n-- readonly: x\nSELECT":          "line 2: invalid readonly value: x",
+		"-- name: Q\n-- minSchemaVersion: v1\nSELECT": "line 2: invalid minSchemaVersion: v1",
+		"-- name: Q\n\n-- name: R\nSELECT 1":          "line 1: query Q has no SQL",
+		"-- name:\nSELECT 1":                          "line 1: empty query name",
+	}
+	for data, expected := range cases {
+		_, err := parseSQLQueries([]byte(data))
+		assert.EqualError(t, err, expected)
+	}
+}
+
+func TestParseQueryFileReportsLocation(t *testing.T) {
+	_, err := parseQueryFile("bad.sql", []byte("SELECT 1"))
+
+	assert.EqualError(t, err, "bad.sql: line 1: SQL found before the first -- name: comment")
+}
+
+func TestLoadYAMLQueries(t *testing.T) {
+	// when
+	queryMap, err := LoadNamedQueries("db/queries/test_queries.yaml")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(queryMap))
+
+	value := queryMap["FindTest"]
+	assert.Equal(t, "SELECT ColA\nFROM test\nWHERE ColA = :cola\n", value.Query)
+	assert.Equal(t, "Finds a row in the test table by its primary key.", value.Description)
+	assert.Equal(t, "INSERT INTO test (ColA) VALUES (:cola)", queryMap.Q("InsertTest"))
+}
+
+func TestParseYAMLQueriesErrors(t *testing.T) {
+	cases := map[string]string{
+		"- a\n- b":                          "q.yml: line 1: expected a mapping of query names to queries",
+		"Q:\n  query: a\nR: SELECT 1":       "q.yml: line 3: expected a query object for R",
+		"Q:\n  query: [a, b]":               "q.yml: line 2: query must be a string or a mapping of dialects to queries",
+		"Q:\n  description: [a, b]":         "q.yml: yaml: unmarshal errors:\n  line 2: cannot unmarshal !!seq into string",
+		"Q:\n  query: a\nR:\n  query: 'x\n": "q.yml: yaml: line 4: found unexpected end of stream",
+	}
+	for data, expected := range cases {
+		_, err := parseQueryFile("q.yml", []byte(data))
+		assert.EqualError(t, err, expected)
+	}
+}
+
+func TestParseYAMLQueriesEmpty(t *testing.T) {
+	file, err := parseYAMLQueries([]byte(""))
+
+	assert.NoError(t, err)
+	assert.Empty(t, file.entries)
+}
+
+func TestParseDirectives(t *testing.T) {
+	// given
+	files := map[string]string{
+		"q.json": "{\n\"$namespace\": \"users\",\n\"$include\": [\"a.json\", \"b.sql\"],\n\"Find\": {\"query\": \"x\"}\n}",
+		"q.yaml": "$namespace: users\n$include:\n  - a.json\n  - b.sql\nFind:\n  query: x\n",
+		"q.sql":  "-- namespace: users\n-- include: a.json\n-- include: b.sql\n-- name: Find\nx\n",
+	}
+	for location, data := range files {
+		// when
+		file, err := parseQueryFile(location, []byte(data))
+
+		// then
+		assert.NoError(t, err, location)
+		assert.Equal(t, "users", file.namespace, location)
+		assert.Len(t, file.includes, 2, location)
+		assert.Equal(t, "a.json", file.includes[0].path, location)
+		assert.Equal(t, "b.sql", file.includes[1].path, location)
+		assert.Len(t, file.entries, 1, location)
+	}
+}
+
+func TestParseDirectiveErrors(t *testing.T) {
+	cases := map[string]string{
+		"q.json": "{\n\"$unknown\": \"x\"\n}",
+		"q.yaml": "$namespace: a\n$namespace: b\n",
+	}
+	expected := map[string]string{
+		"q.json": "q.json: line 2: unknown directive: unknown",
+		"q.yaml": "q.yaml: line 2: namespace declared more than once",
+	}
+	for location, data := range cases {
+		_, err := parseQueryFile(location, []byte(data))
+		assert.EqualError(t, err, expected[location])
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseYAMLQueries parses a YAML query file using the same schema as JSON query files, a mapping of query names to objects holding a query and description, including the $namespace, $include and $fragments directives. Block scalars may be used for long queries. Returns an error reporting the line number if the document is malformed or does not follow the schema.
+func parseYAMLQueries(data []byte) (*queryFile, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 {
+		// an empty document contains no queries
+		return &queryFile{}, nil
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping of query names to queries", root.Line)
+	}
+	file := &queryFile{entries: make([]queryEntry, 0, len(root.Content)/2)}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if key.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("line %d: query names must be scalar values", key.Line)
+		}
+		if key.Value == directivePrefix+fragmentsDirective {
+			fragments, err := decodeYAMLFragments(value)
+			if err != nil {
+				return nil, err
+			}
+			file.fragments = append(file.fragments, fragments...)
+			continue
+		}
+		if strings.HasPrefix(key.Value, directivePrefix) {
+			values, err := decodeYAMLDirective(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v must be a string or a sequence of strings", value.Line, key.Value)
+			}
+			if err := file.addDirective(strings.TrimPrefix(key.Value, directivePrefix), values, key.Line); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if value.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %d: expected a query object for %v", value.Line, key.Value)
+		}
+		var document queryDocument
+		if err := value.Decode(&document); err != nil {
+			return nil, err
+		}
+		queryValue, err := document.value()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", key.Line, err)
+		}
+		fields := make([]string, 0, len(value.Content)/2)
+		var queryLine, paramsLine int
+		for j := 0; j+1 < len(value.Content); j += 2 {
+			field, fieldValue := value.Content[j], value.Content[j+1]
+			fields = append(fields, field.Value)
+			switch field.Value {
+			case "query":
+				queryLine = yamlQueryLine(fieldValue)
+			case "params":
+				if len(queryValue.Params) > 0 {
+					paramsLine = fieldValue.Line
+				}
+			}
+		}
+		file.entries = append(file.entries, queryEntry{name: key.Value, value: queryValue, line: key.Line, queryLine: queryLine, paramsLine: paramsLine, unknownFields: unknownFields(fields)})
+	}
+	return file, nil
+}
+
+// yamlQueryLine returns the line on which the text of a query scalar begins, or zero if the lines of the text do not correspond to lines of the file. Only literal block scalars, which begin on the line following their indicator, and single line scalars preserve lines.
+func yamlQueryLine(node *yaml.Node) int {
+	switch {
+	case node.Kind != yaml.ScalarNode:
+		return 0
+	case node.Style&yaml.LiteralStyle != 0:
+		return node.Line + 1
+	case !strings.Contains(node.Value, "\n"):
+		return node.Line
+	}
+	return 0
+}
+
+// decodeYAMLDirective decodes a directive value given as either a scalar or a sequence of scalars.
+func decodeYAMLDirective(node *yaml.Node) ([]string, error) {
+	if node.Kind == yaml.ScalarNode {
+		return []string{node.Value}, nil
+	}
+	var values []string
+	if err := node.Decode(&values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// decodeYAMLFragments decodes a mapping of fragment names to SQL.
+func decodeYAMLFragments(node *yaml.Node) ([]queryFragment, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: %v%v must be a mapping of fragment names to SQL", node.Line, directivePrefix, fragmentsDirective)
+	}
+	fragments := make([]queryFragment, 0, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Kind != yaml.ScalarNode || value.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("line %d: fragments must map a name to SQL", key.Line)
+		}
+		fragments = append(fragments, queryFragment{name: key.Value, text: value.Value, line: key.Line})
+	}
+	return fragments, nil
+}
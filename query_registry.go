@@ -0,0 +1,220 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// QueryRegistryOptions configures how a QueryRegistry loads, validates and watches its query files.
+type QueryRegistryOptions struct {
+	// LoadOptions are used every time the query files are loaded.
+	LoadOptions QueryLoadOptions
+	// Validate, if set, is called with every newly loaded set of queries. A set that fails validation is never made visible, and is loaded and validated again on the next poll. For example, QueryMap.Validate may be used to verify the queries against a live schema.
+	Validate func(QueryMap) error
+	// PollInterval, if positive, enables polling the query files for changes, reloading them whenever a file is modified, added or removed.
+	PollInterval time.Duration
+	// OnReload, if set, is called after every reload triggered by a file change, whether or not the reload succeeded.
+	OnReload func(QueryReloadEvent)
+}
+
+// QueryReloadEvent describes the outcome of a reload triggered by a file change.
+type QueryReloadEvent struct {
+	// Queries holds the newly active queries, or nil if the reload failed.
+	Queries QueryMap
+	// Err holds the load or validation error if the reload failed, in which case the previously loaded queries remain active.
+	Err error
+	// Time is when the reload completed.
+	Time time.Time
+}
+
+// QueryRegistry holds a set of named queries that may be safely reloaded while other goroutines read from it. The active queries are held in an atomically swapped snapshot, which is only replaced once a newly loaded set has been fully parsed and validated.
+type QueryRegistry struct {
+	options   QueryRegistryOptions
+	locations []string
+	snapshot  atomic.Value
+	// mu serializes reloads and guards stamps
+	mu        sync.Mutex
+	stamps    map[string]fileStamp
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// fileStamp captures the state of a watched file. A zero stamp represents a missing file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewQueryRegistry loads and validates the queries found at the given file locations, returning an error if the initial load fails. If a poll interval is configured, the files are watched until Close is called.
+func NewQueryRegistry(opts QueryRegistryOptions, fileLocations ...string) (*QueryRegistry, error) {
+	r := &QueryRegistry{
+		options:   opts,
+		locations: fileLocations,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	if opts.PollInterval > 0 {
+		r.stop = make(chan struct{})
+		r.done = make(chan struct{})
+		go r.watch()
+	}
+	return r, nil
+}
+
+// MustNewQueryRegistry calls NewQueryRegistry and panics if an error occurs while loading the queries.
+func MustNewQueryRegistry(opts QueryRegistryOptions, fileLocations ...string) *QueryRegistry {
+	r, err := NewQueryRegistry(opts, fileLocations...)
+	if err != nil {
+		panic(fmt.Sprintf("Error loading named queries: %v", err))
+	}
+	return r
+}
+
+// Queries returns the currently active snapshot of queries. The returned map is shared and must not be modified.
+func (r *QueryRegistry) Queries() QueryMap {
+	return r.snapshot.Load().(QueryMap)
+}
+
+// Q finds and returns the query string for the given identifier from the active snapshot, panic'ing if a query was not found.
+func (r *QueryRegistry) Q(name string) string {
+	return r.Queries().Q(name)
+}
+
+// Reload loads and validates the query files, replacing the active snapshot on success. Returns an error, leaving the active snapshot untouched, if any file fails to load or the queries fail validation.
+func (r *QueryRegistry) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.reload()
+	return err
+}
+
+// Close stops watching the query files. The registry remains usable.
+func (r *QueryRegistry) Close() {
+	r.closeOnce.Do(func() {
+		if r.stop != nil {
+			close(r.stop)
+			<-r.done
+		}
+	})
+}
+
+// reload performs a reload, returning the newly active queries. Must be called with mu held.
+func (r *QueryRegistry) reload() (QueryMap, error) {
+	loader, err := loadNamedQueries(r.options.LoadOptions, r.locations)
+	if err != nil {
+		// the files touched by the failed load, including the file that failed, are stamped so that an unchanged broken file is not reloaded on every poll, while fixing it triggers a reload
+		r.stamps = r.fingerprint(loader.files)
+		return nil, err
+	}
+	if r.options.Validate != nil {
+		// the stamps are left untouched so that queries failing validation, for example against a schema that has yet to be migrated, are retried on the next poll
+		if err := r.options.Validate(loader.queries); err != nil {
+			return nil, err
+		}
+	}
+	r.stamps = r.fingerprint(loader.files)
+	r.snapshot.Store(loader.queries)
+	return loader.queries, nil
+}
+
+// watch polls the query files until the registry is closed.
+func (r *QueryRegistry) watch() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.options.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.poll()
+		}
+	}
+}
+
+// poll reloads the queries if any watched file has changed since the last reload.
+func (r *QueryRegistry) poll() {
+	r.mu.Lock()
+	if !r.changed() {
+		r.mu.Unlock()
+		return
+	}
+	queries, err := r.reload()
+	r.mu.Unlock()
+	if r.options.OnReload != nil {
+		r.options.OnReload(QueryReloadEvent{
+			Queries: queries,
+			Err:     err,
+			Time:    time.Now(),
+		})
+	}
+}
+
+// changed reports whether the watched files differ from those seen by the last reload. Must be called with mu held.
+func (r *QueryRegistry) changed() bool {
+	current := r.fingerprint(r.loadedFiles())
+	if len(current) != len(r.stamps) {
+		return true
+	}
+	for file, stamp := range current {
+		if previous, ok := r.stamps[file]; !ok || previous != stamp {
+			return true
+		}
+	}
+	return false
+}
+
+// loadedFiles returns the files seen by the last reload. Must be called with mu held.
+func (r *QueryRegistry) loadedFiles() []string {
+	files := make([]string, 0, len(r.stamps))
+	for file := range r.stamps {
+		files = append(files, file)
+	}
+	return files
+}
+
+// fingerprint stamps the given files along with every file the configured locations currently resolve to, so that newly matching files are detected.
+func (r *QueryRegistry) fingerprint(files []string) map[string]fileStamp {
+	loader := &queryLoader{options: r.options.LoadOptions}
+	stamps := make(map[string]fileStamp)
+	stampFile := func(file string) {
+		if info, err := loader.stat(file); err == nil {
+			stamps[file] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		} else {
+			stamps[file] = fileStamp{}
+		}
+	}
+	for _, location := range r.locations {
+		resolved, err := loader.resolve(location)
+		if err != nil {
+			// a pattern that matches nothing is tracked as a missing file
+			stamps[location] = fileStamp{}
+			continue
+		}
+		for _, file := range resolved {
+			stampFile(file)
+		}
+	}
+	for _, file := range files {
+		stampFile(file)
+	}
+	return stamps
+}
@@ -0,0 +1,165 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeQueryFile atomically replaces a file so that a poll never observes a partially written file.
+func writeQueryFile(t *testing.T, file, contents string, modTime time.Time) {
+	tmp := file + ".tmp"
+	assert.NoError(t, ioutil.WriteFile(tmp, []byte(contents), 0644))
+	assert.NoError(t, os.Chtimes(tmp, modTime, modTime))
+	assert.NoError(t, os.Rename(tmp, file))
+}
+
+func waitForReload(t *testing.T, events chan QueryReloadEvent) QueryReloadEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a reload")
+	}
+	return QueryReloadEvent{}
+}
+
+func TestQueryRegistry(t *testing.T) {
+	// when
+	registry, err := NewQueryRegistry(QueryRegistryOptions{}, "db/queries/test_queries.json")
+
+	// then
+	assert.NoError(t, err)
+	defer registry.Close()
+	assert.Equal(t, "query1", registry.Q("Query1"))
+	assert.Equal(t, 2, len(registry.Queries()))
+	assert.NoError(t, registry.Reload())
+}
+
+func TestQueryRegistryInitialLoadFailure(t *testing.T) {
+	// given
+	opts := QueryRegistryOptions{Validate: func(QueryMap) error {
+		return errors.New("invalid")
+	}}
+
+	// when
+	_, loadErr := NewQueryRegistry(QueryRegistryOptions{}, "abc")
+	_, validateErr := NewQueryRegistry(opts, "db/queries/test_queries.json")
+
+	// then
+	assert.Error(t, loadErr)
+	assert.EqualError(t, validateErr, "invalid")
+	assert.Panics(t, func() {
+		MustNewQueryRegistry(QueryRegistryOptions{}, "abc")
+	})
+}
+
+func TestQueryRegistryWatch(t *testing.T) {
+	// given
+	file := filepath.Join(t.TempDir(), "queries.json")
+	start := time.Now().Add(-time.Hour)
+	writeQueryFile(t, file, `{"QueryA": {"query": "a"}}`, start)
+	events := make(chan QueryReloadEvent, 10)
+	opts := QueryRegistryOptions{
+		PollInterval: 10 * time.Millisecond,
+		OnReload: func(event QueryReloadEvent) {
+			events <- event
+		},
+		Validate: func(queryMap QueryMap) error {
+			if _, ok := queryMap["Invalid"]; ok {
+				return errors.New("invalid query")
+			}
+			return nil
+		},
+	}
+	registry, err := NewQueryRegistry(opts, file)
+	assert.NoError(t, err)
+	defer registry.Close()
+
+	// when a file is changed, the new queries are swapped in
+	writeQueryFile(t, file, `{"QueryA": {"query": "changed"}}`, start.Add(time.Minute))
+	event := waitForReload(t, events)
+
+	// then
+	assert.NoError(t, event.Err)
+	assert.Equal(t, "changed", event.Queries.Q("QueryA"))
+	assert.Equal(t, "changed", registry.Q("QueryA"))
+
+	// when a file no longer parses, the previous queries remain active
+	writeQueryFile(t, file, `{"QueryA": `, start.Add(2*time.Minute))
+	event = waitForReload(t, events)
+
+	// then
+	assert.Error(t, event.Err)
+	assert.Nil(t, event.Queries)
+	assert.Equal(t, "changed", registry.Q("QueryA"))
+
+	// when the queries fail validation, the previous queries remain active
+	writeQueryFile(t, file, `{"Invalid": {"query": "x"}}`, start.Add(3*time.Minute))
+	event = waitForReload(t, events)
+
+	// then
+	assert.EqualError(t, event.Err, "invalid query")
+	assert.Equal(t, "changed", registry.Q("QueryA"))
+
+	// when the queries failed validation, they are validated again on the next poll
+	event = waitForReload(t, events)
+
+	// then
+	assert.EqualError(t, event.Err, "invalid query")
+}
+
+func TestQueryRegistryWatchFailedInclude(t *testing.T) {
+	// given
+	dir := t.TempDir()
+	file := filepath.Join(dir, "queries.json")
+	include := filepath.Join(dir, "include.json")
+	start := time.Now().Add(-time.Hour)
+	writeQueryFile(t, file, `{"QueryA": {"query": "a"}}`, start)
+	events := make(chan QueryReloadEvent, 10)
+	opts := QueryRegistryOptions{
+		PollInterval: 10 * time.Millisecond,
+		OnReload: func(event QueryReloadEvent) {
+			events <- event
+		},
+	}
+	registry, err := NewQueryRegistry(opts, file)
+	assert.NoError(t, err)
+	defer registry.Close()
+
+	// when a newly added include is broken
+	writeQueryFile(t, include, `{"QueryB": `, start)
+	writeQueryFile(t, file, `{"$include": "include.json", "QueryA": {"query": "a"}}`, start.Add(time.Minute))
+	event := waitForReload(t, events)
+
+	// then
+	assert.Error(t, event.Err)
+	assert.Equal(t, 1, len(registry.Queries()))
+
+	// when only the include is fixed
+	writeQueryFile(t, include, `{"QueryB": {"query": "b"}}`, start.Add(time.Minute))
+	event = waitForReload(t, events)
+
+	// then
+	assert.NoError(t, event.Err)
+	assert.Equal(t, "b", registry.Q("QueryB"))
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CheckSchemaVersion verifies that every query can run against a schema migrated to the given version. Returns a QueryValidationError listing, ordered by name, every query whose minimum schema version is later than version.
+func (q QueryMap) CheckSchemaVersion(version int64) error {
+	names := make([]string, 0, len(q))
+	for name, value := range q {
+		if value.MinSchemaVersion > version {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	queryErrors := make([]*QueryError, 0, len(names))
+	for _, name := range names {
+		queryErrors = append(queryErrors, &QueryError{Name: name, Err: fmt.Errorf("requires schema version %d, the schema is at version %d", q[name].MinSchemaVersion, version)})
+	}
+	return &QueryValidationError{Errors: queryErrors}
+}
+
+// CheckDBSchemaVersion retrieves the current version of the schema using GetCurrentSchemaVersion, and verifies that every query can run against it, as CheckSchemaVersion does. Intended to be called at startup, so that a binary deployed ahead of its database migrations fails fast.
+func (q QueryMap) CheckDBSchemaVersion(schema string, db *sqlx.DB) error {
+	version, err := GetCurrentSchemaVersion(schema, db)
+	if err != nil {
+		return err
+	}
+	return q.CheckSchemaVersion(version)
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMinSchemaVersion(t *testing.T) {
+	// when
+	queryMap, err := LoadNamedQueriesWithOptions(QueryLoadOptions{Strict: true}, "db/queries/versioned_queries.sql")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), queryMap["FindTest"].MinSchemaVersion)
+	assert.Equal(t, int64(20190601120000), queryMap["FindTestB"].MinSchemaVersion)
+	assert.Equal(t, int64(0), queryMap["Now"].MinSchemaVersion)
+}
+
+func TestCheckSchemaVersion(t *testing.T) {
+	// given
+	queryMap := MustLoadNamedQueries("db/queries/versioned_queries.sql")
+
+	// then
+	assert.NoError(t, queryMap.CheckSchemaVersion(20190601120000))
+	assert.EqualError(t, queryMap.CheckSchemaVersion(1), "1 named queries failed validation:\n  FindTestB: requires schema version 20190601120000, the schema is at version 1")
+	err := queryMap.CheckSchemaVersion(0)
+	validationErr, ok := err.(*QueryValidationError)
+	assert.True(t, ok)
+	assert.Len(t, validationErr.Errors, 2)
+	assert.Equal(t, "FindTest", validationErr.Errors[0].Name)
+}
+
+func TestCheckDBSchemaVersion(t *testing.T) {
+	// given
+	schema := GenerateSchemaName("versionschema")
+	db := setupTestDB(t, schema)
+	queryMap := MustLoadNamedQueries("db/queries/versioned_queries.sql")
+
+	// when
+	err := queryMap.CheckDBSchemaVersion(schema, db)
+
+	// then
+	validationErr, ok := err.(*QueryValidationError)
+	assert.True(t, ok)
+	assert.Len(t, validationErr.Errors, 1)
+	assert.Equal(t, "FindTestB", validationErr.Errors[0].Name)
+}
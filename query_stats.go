@@ -0,0 +1,217 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the latency histogram buckets recorded for each query. Executions slower than the last bound are counted in a final unbounded bucket.
+var LatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// QueryStats records usage statistics for each named query. A QueryStats is safe for concurrent use, and also serves the statistics over HTTP as JSON or HTML.
+type QueryStats struct {
+	queries QueryMap
+	mu      sync.Mutex
+	stats   map[string]*queryStat
+}
+
+// queryStat accumulates the statistics of a single query.
+type queryStat struct {
+	count     int64
+	errors    int64
+	totalTime time.Duration
+	maxTime   time.Duration
+	buckets   []int64
+}
+
+// QueryStat is a point in time copy of the statistics of a single named query. Durations are encoded in JSON as nanoseconds.
+type QueryStat struct {
+	Name      string          `json:"name"`
+	Query     string          `json:"query"`
+	Count     int64           `json:"count"`
+	Errors    int64           `json:"errors"`
+	TotalTime time.Duration   `json:"totalTime"`
+	MeanTime  time.Duration   `json:"meanTime"`
+	MaxTime   time.Duration   `json:"maxTime"`
+	Histogram []LatencyBucket `json:"histogram"`
+}
+
+// LatencyBucket counts the executions completing within an upper bound, and above the bound of the previous bucket. The upper bound of the final bucket is "+Inf".
+type LatencyBucket struct {
+	UpperBound string `json:"le"`
+	Count      int64  `json:"count"`
+}
+
+// NewQueryStats returns an empty set of statistics for the queries. The query map supplies the query text reported alongside each query's statistics.
+func NewQueryStats(queries QueryMap) *QueryStats {
+	return &QueryStats{queries: queries, stats: make(map[string]*queryStat)}
+}
+
+// Record records a single execution of the named query, taking the given duration and failing if err is not nil.
+func (s *QueryStats) Record(name string, duration time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stat, ok := s.stats[name]
+	if !ok {
+		stat = &queryStat{buckets: make([]int64, len(LatencyBuckets)+1)}
+		s.stats[name] = stat
+	}
+	stat.count++
+	if err != nil {
+		stat.errors++
+	}
+	stat.totalTime += duration
+	if duration > stat.maxTime {
+		stat.maxTime = duration
+	}
+	stat.buckets[sort.Search(len(LatencyBuckets), func(i int) bool { return duration <= LatencyBuckets[i] })]++
+}
+
+// Reset discards all recorded statistics.
+func (s *QueryStats) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats = make(map[string]*queryStat)
+}
+
+// Snapshot returns the statistics of every query executed at least once, ordered by total time descending.
+func (s *QueryStats) Snapshot() []QueryStat {
+	s.mu.Lock()
+	snapshot := make([]QueryStat, 0, len(s.stats))
+	for name, stat := range s.stats {
+		histogram := make([]LatencyBucket, len(stat.buckets))
+		for i, count := range stat.buckets {
+			histogram[i] = LatencyBucket{UpperBound: "+Inf", Count: count}
+			if i < len(LatencyBuckets) {
+				histogram[i].UpperBound = LatencyBuckets[i].String()
+			}
+		}
+		snapshot = append(snapshot, QueryStat{
+			Name:      name,
+			Query:     s.queries[name].Query,
+			Count:     stat.count,
+			Errors:    stat.errors,
+			TotalTime: stat.totalTime,
+			MeanTime:  stat.totalTime / time.Duration(stat.count),
+			MaxTime:   stat.maxTime,
+			Histogram: histogram,
+		})
+	}
+	s.mu.Unlock()
+	sortQueryStats(snapshot, "")
+	return snapshot
+}
+
+// queryStatOrders orders query statistics by a sort key. Numeric keys order descending, while name orders ascending.
+var queryStatOrders = map[string]func(a, b QueryStat) bool{
+	"name":   func(a, b QueryStat) bool { return a.Name < b.Name },
+	"count":  func(a, b QueryStat) bool { return a.Count > b.Count },
+	"errors": func(a, b QueryStat) bool { return a.Errors > b.Errors },
+	"total":  func(a, b QueryStat) bool { return a.TotalTime > b.TotalTime },
+	"mean":   func(a, b QueryStat) bool { return a.MeanTime > b.MeanTime },
+	"max":    func(a, b QueryStat) bool { return a.MaxTime > b.MaxTime },
+}
+
+// sortQueryStats sorts statistics by the given key, defaulting to total time, breaking ties by name.
+func sortQueryStats(stats []QueryStat, key string) {
+	less, ok := queryStatOrders[key]
+	if !ok {
+		less = queryStatOrders["total"]
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		if less(stats[i], stats[j]) {
+			return true
+		}
+		if less(stats[j], stats[i]) {
+			return false
+		}
+		return stats[i].Name < stats[j].Name
+	})
+}
+
+// ServeHTTP renders the statistics as JSON if the format query parameter is "json" or the request accepts application/json, and as an HTML table otherwise. The sort query parameter orders the statistics by name, count, errors, total, mean or max, defaulting to total time.
+func (s *QueryStats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stats := s.Snapshot()
+	sortQueryStats(stats, r.URL.Query().Get("sort"))
+	format := r.URL.Query().Get("format")
+	if format == "json" || (format == "" && strings.Contains(r.Header.Get("Accept"), "application/json")) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := queryStatsTemplate.Execute(w, stats); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var queryStatsTemplate = template.Must(template.New("stats").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>Named Query Statistics</title>
+<style>
+table { border-collapse: collapse; font-family: sans-serif; font-size: small; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; vertical-align: top; }
+td.name, td.query { text-align: left; }
+pre { margin: 0; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<table>
+<tr>
+<th><a href="?sort=name">Query</a></th>
+<th><a href="?sort=count">Calls</a></th>
+<th><a href="?sort=errors">Errors</a></th>
+<th><a href="?sort=total">Total</a></th>
+<th><a href="?sort=mean">Mean</a></th>
+<th><a href="?sort=max">Max</a></th>
+<th>Latency</th>
+<th>SQL</th>
+</tr>
+{{- range .}}
+<tr>
+<td class="name">{{.Name}}</td>
+<td>{{.Count}}</td>
+<td>{{.Errors}}</td>
+<td>{{.TotalTime}}</td>
+<td>{{.MeanTime}}</td>
+<td>{{.MaxTime}}</td>
+<td>{{range .Histogram}}{{if .Count}}&le;{{.UpperBound}}: {{.Count}}<br>{{end}}{{end}}</td>
+<td class="query"><pre>{{.Query}}</pre></td>
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,116 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryStatsSnapshot(t *testing.T) {
+	// given
+	stats := NewQueryStats(QueryMap{"Fast": {Query: "SELECT 1"}, "Slow": {Query: "SELECT pg_sleep(1)"}})
+
+	// when
+	stats.Record("Fast", 500*time.Microsecond, nil)
+	stats.Record("Fast", 3*time.Millisecond, errors.New("failed"))
+	stats.Record("Slow", time.Second, nil)
+	stats.Record("Slow", time.Minute, nil)
+	snapshot := stats.Snapshot()
+
+	// then
+	assert.Len(t, snapshot, 2)
+	slow := snapshot[0]
+	assert.Equal(t, "Slow", slow.Name)
+	assert.Equal(t, "SELECT pg_sleep(1)", slow.Query)
+	assert.Equal(t, int64(2), slow.Count)
+	assert.Equal(t, 61*time.Second, slow.TotalTime)
+	assert.Equal(t, 30500*time.Millisecond, slow.MeanTime)
+	assert.Equal(t, time.Minute, slow.MaxTime)
+	assert.Equal(t, LatencyBucket{UpperBound: "1s", Count: 1}, slow.Histogram[8])
+	assert.Equal(t, LatencyBucket{UpperBound: "+Inf", Count: 1}, slow.Histogram[len(LatencyBuckets)])
+	fast := snapshot[1]
+	assert.Equal(t, int64(2), fast.Count)
+	assert.Equal(t, int64(1), fast.Errors)
+	assert.Equal(t, LatencyBucket{UpperBound: "1ms", Count: 1}, fast.Histogram[0])
+	assert.Equal(t, LatencyBucket{UpperBound: "5ms", Count: 1}, fast.Histogram[1])
+
+	// when
+	stats.Reset()
+
+	// then
+	assert.Empty(t, stats.Snapshot())
+}
+
+func TestQueryStatsHandler(t *testing.T) {
+	// given
+	stats := NewQueryStats(QueryMap{"A": {Query: "SELECT a < 1"}, "B": {Query: "SELECT b"}})
+	stats.Record("A", time.Second, nil)
+	stats.Record("B", time.Millisecond, nil)
+	stats.Record("B", time.Millisecond, nil)
+
+	// when
+	jsonResponse := httptest.NewRecorder()
+	stats.ServeHTTP(jsonResponse, httptest.NewRequest("GET", "/debug/queries?format=json&sort=count", nil))
+	acceptResponse := httptest.NewRecorder()
+	acceptRequest := httptest.NewRequest("GET", "/debug/queries", nil)
+	acceptRequest.Header.Set("Accept", "application/json")
+	stats.ServeHTTP(acceptResponse, acceptRequest)
+	htmlResponse := httptest.NewRecorder()
+	stats.ServeHTTP(htmlResponse, httptest.NewRequest("GET", "/debug/queries", nil))
+
+	// then
+	var byCount []QueryStat
+	assert.NoError(t, json.Unmarshal(jsonResponse.Body.Bytes(), &byCount))
+	assert.Equal(t, "application/json", jsonResponse.Header().Get("Content-Type"))
+	assert.Equal(t, []string{"B", "A"}, []string{byCount[0].Name, byCount[1].Name})
+	var byTotal []QueryStat
+	assert.NoError(t, json.Unmarshal(acceptResponse.Body.Bytes(), &byTotal))
+	assert.Equal(t, []string{"A", "B"}, []string{byTotal[0].Name, byTotal[1].Name})
+	html := htmlResponse.Body.String()
+	assert.Equal(t, "text/html; charset=utf-8", htmlResponse.Header().Get("Content-Type"))
+	assert.Contains(t, html, "<pre>SELECT a &lt; 1</pre>")
+	assert.True(t, strings.Index(html, ">A<") < strings.Index(html, ">B<"))
+}
+
+func TestQueryExecutorWithStats(t *testing.T) {
+	// given
+	db := &recordingContext{}
+	queryMap := QueryMap{"Insert": {Query: "INSERT INTO test (ColA) VALUES (:cola)"}}
+	stats := NewQueryStats(queryMap)
+	executor := NewQueryExecutor(queryMap, db).WithStats(stats)
+
+	// when
+	_, okErr := executor.Exec(context.Background(), "Insert", map[string]interface{}{"cola": 1})
+	db.err = errors.New("failed")
+	_, failedErr := executor.Exec(context.Background(), "Insert", map[string]interface{}{"cola": 1})
+	_, missingErr := executor.Exec(context.Background(), "Missing", nil)
+
+	// then
+	assert.NoError(t, okErr)
+	assert.Error(t, failedErr)
+	assert.Error(t, missingErr)
+	snapshot := stats.Snapshot()
+	assert.Len(t, snapshot, 1)
+	assert.Equal(t, int64(2), snapshot[0].Count)
+	assert.Equal(t, int64(1), snapshot[0].Errors)
+}
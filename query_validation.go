@@ -0,0 +1,102 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// NamedPreparerContext prepares queries containing named parameters. Both *sqlx.DB and *sqlx.Tx satisfy this interface.
+type NamedPreparerContext interface {
+	// PrepareNamedContext prepares a query with named parameters. Returns a prepared statement or an error.
+	PrepareNamedContext(ctx context.Context, query string) (*sqlx.NamedStmt, error)
+}
+
+// QueryError associates an error with the named query that caused it.
+type QueryError struct {
+	Name string
+	Err  error
+}
+
+// Error returns the query name followed by the underlying error. Postgres errors include the position within the query at which the error was detected.
+func (e *QueryError) Error() string {
+	var pqErr *pq.Error
+	if errors.As(e.Err, &pqErr) && pqErr.Position != "" {
+		return fmt.Sprintf("%v: %v (position %v)", e.Name, e.Err, pqErr.Position)
+	}
+	return fmt.Sprintf("%v: %v", e.Name, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// newQueryError associates err with the named query, unless err already identifies a query.
+func newQueryError(name string, err error) error {
+	var queryErr *QueryError
+	var notFoundErr *QueryNotFoundError
+	if errors.As(err, &queryErr) || errors.As(err, &notFoundErr) {
+		return err
+	}
+	return &QueryError{Name: name, Err: err}
+}
+
+// QueryValidationError aggregates the errors of every named query that failed validation.
+type QueryValidationError struct {
+	Errors []*QueryError
+}
+
+// Error lists each failing query on its own line.
+func (e *QueryValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors)+1)
+	messages = append(messages, fmt.Sprintf("%d named queries failed validation:", len(e.Errors)))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n  ")
+}
+
+// Validate prepares every query against the database, without executing it, so that syntax errors and references to missing tables or columns are detected at startup rather than on first use. Named parameters are compiled in the same manner as PrepareNamed. Postgres only parses and plans a statement when preparing it, so validation has no side effects. Returns a QueryValidationError listing every query that failed to prepare, ordered by name, or the context error if ctx is done. As a failing statement aborts a Postgres transaction, db should not be a transaction.
+func (q QueryMap) Validate(ctx context.Context, db NamedPreparerContext) error {
+	names := make([]string, 0, len(q))
+	for name := range q {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var queryErrors []*QueryError
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		stmt, err := db.PrepareNamedContext(ctx, q[name].Query)
+		if err != nil {
+			queryErrors = append(queryErrors, &QueryError{Name: name, Err: err})
+			continue
+		}
+		stmt.Close()
+	}
+	if len(queryErrors) > 0 {
+		return &QueryValidationError{Errors: queryErrors}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateQueries(t *testing.T) {
+	// given
+	db := setupTestDB(t, GenerateSchemaName("validateschema"))
+	queryMap := MustLoadNamedQueries("db/queries/validate_queries.json")
+
+	// when
+	err := queryMap.Validate(context.Background(), db)
+
+	// then
+	validationErr, ok := err.(*QueryValidationError)
+	assert.True(t, ok)
+	assert.Len(t, validationErr.Errors, 2)
+	assert.Equal(t, "MissingColumn", validationErr.Errors[0].Name)
+	assert.Equal(t, "SyntaxError", validationErr.Errors[1].Name)
+	var pqErr *pq.Error
+	assert.True(t, errors.As(validationErr.Errors[0], &pqErr))
+	assert.Equal(t, "8", pqErr.Position)
+
+	// valid queries pass
+	delete(queryMap, "MissingColumn")
+	delete(queryMap, "SyntaxError")
+	assert.NoError(t, queryMap.Validate(context.Background(), db))
+}
+
+func TestQueryValidationErrorMessage(t *testing.T) {
+	// given
+	err := &QueryValidationError{Errors: []*QueryError{
+		{Name: "QueryA", Err: &pq.Error{Message: `column "colb" does not exist`, Position: "8"}},
+		{Name: "QueryB", Err: errors.New("unexpected `:` while reading named param at 10")},
+	}}
+
+	// then
+	assert.Equal(t, "2 named queries failed validation:\n  QueryA: pq: column \"colb\" does not exist (position 8)\n  QueryB: unexpected `:` while reading named param at 10", err.Error())
+}
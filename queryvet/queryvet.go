@@ -0,0 +1,267 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package queryvet defines an analyzer that reports references to named queries that are not defined in the project's query files, and queries that are defined but never referenced.
+//
+// A query is referenced when a constant string is passed as the query name to one of the dbx functions that look up a named query, such as QueryMap.Q. Constants are resolved by the type checker, so a name may be passed through any number of constant declarations. Undefined references are reported where they occur. As finding unused queries requires every referencing package, unused queries are reported in main packages that, along with their dependencies, reference at least one query, or in the packages named by the -unused-in flag, using the references of all of their dependencies.
+//
+// Relative -queries patterns are resolved against the root of the module containing the analyzed package, the nearest directory above it holding a go.mod file, as go vet runs the analyzer from the directory of each package.
+package queryvet
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dakiva/dbx"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+const dbxPath = "github.com/dakiva/dbx"
+
+// Analyzer reports undefined and unused named queries. The -queries flag lists the query files to check against.
+var Analyzer = &analysis.Analyzer{
+	Name:      "dbxqueries",
+	Doc:       "reports references to undefined named queries and named queries that are never referenced",
+	Run:       run,
+	Requires:  []*analysis.Analyzer{inspect.Analyzer},
+	FactTypes: []analysis.Fact{new(queryReferences)},
+}
+
+var (
+	queryPatterns         string
+	dialect               string
+	namespaceFromFileName bool
+	unusedIn              string
+)
+
+func init() {
+	Analyzer.Flags.StringVar(&queryPatterns, "queries", "", "comma separated list of query files or glob patterns, relative to the module root")
+	Analyzer.Flags.StringVar(&dialect, "dialect", "", "dialect used to select query variants")
+	Analyzer.Flags.BoolVar(&namespaceFromFileName, "namespace-from-file-name", false, "derives a namespace from the file name of query files that do not declare one")
+	Analyzer.Flags.StringVar(&unusedIn, "unused-in", "", "comma separated list of package paths in which to report unused queries, defaulting to main packages referencing at least one query")
+}
+
+// lookupMethods maps the dbx methods that look up a named query to the index of their query name parameter.
+var lookupMethods = map[string]int{
+	"QueryMap.Q":                    0,
+	"QueryMap.Exec":                 2,
+	"QueryMap.Get":                  3,
+	"QueryMap.Select":               3,
+	"QueryMap.CheckBindings":        0,
+	"QueryRegistry.Q":               0,
+	"QueryExecutor.Exec":            1,
+	"QueryExecutor.Query":           1,
+	"QueryExecutor.Get":             2,
+	"QueryExecutor.Select":          2,
+	"QueryStats.Record":             0,
+	"StmtCache.NamedExecContext":    1,
+	"StmtCache.NamedQueryContext":   1,
+	"TxStmtCache.NamedExecContext":  1,
+	"TxStmtCache.NamedQueryContext": 1,
+}
+
+// queryReferences is a package fact recording the query names referenced by a package.
+type queryReferences struct {
+	Names []string
+}
+
+// AFact marks queryReferences as a fact.
+func (*queryReferences) AFact() {}
+
+func (r *queryReferences) String() string {
+	return fmt.Sprintf("queryReferences(%v)", strings.Join(r.Names, ", "))
+}
+
+var (
+	loadMu sync.Mutex
+	// loaded caches the queries loaded for each combination of module root and flags, as a single process may analyze packages of several modules
+	loaded = make(map[string]dbx.QueryMap)
+)
+
+// loadQueries loads the query files named by the -queries flag, resolving relative patterns against root, once per root.
+func loadQueries(root string) (dbx.QueryMap, error) {
+	key := strings.Join([]string{root, queryPatterns, dialect, fmt.Sprint(namespaceFromFileName)}, "\x00")
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	if queries, ok := loaded[key]; ok {
+		return queries, nil
+	}
+	var files []string
+	for _, pattern := range strings.Split(queryPatterns, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(root, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no query files match pattern: %v", pattern)
+		}
+		files = append(files, matches...)
+	}
+	queries, err := dbx.LoadNamedQueriesWithOptions(dbx.QueryLoadOptions{Dialect: dialect, NamespaceFromFileName: namespaceFromFileName}, files...)
+	if err != nil {
+		return nil, err
+	}
+	loaded[key] = queries
+	return queries, nil
+}
+
+// moduleRoot returns the nearest directory holding a go.mod file above the files of the package, or an empty string, resolving patterns against the working directory, if there is none.
+func moduleRoot(pass *analysis.Pass) string {
+	if len(pass.Files) == 0 {
+		return ""
+	}
+	dir := filepath.Dir(pass.Fset.File(pass.Files[0].Pos()).Name())
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	if queryPatterns == "" {
+		return nil, nil
+	}
+	// references are collected before the query files are loaded, so that packages referencing no queries, such as dependencies in other modules, never load them
+	type reference struct {
+		arg  ast.Expr
+		name string
+	}
+	var references []reference
+	referenced := make(map[string]bool)
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	inspect.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node) {
+		call := n.(*ast.CallExpr)
+		arg := queryNameArg(pass, call)
+		if arg == nil {
+			return
+		}
+		value := pass.TypesInfo.Types[arg].Value
+		if value == nil || value.Kind() != constant.String {
+			return
+		}
+		name := constant.StringVal(value)
+		references = append(references, reference{arg: arg, name: name})
+		referenced[name] = true
+	})
+	reportUnused := len(pass.Files) > 0 && (isUnusedIn(pass.Pkg) || unusedIn == "" && isMain(pass.Pkg))
+	if len(references) == 0 && !reportUnused {
+		return nil, nil
+	}
+	names := make([]string, 0, len(referenced))
+	for name := range referenced {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		pass.ExportPackageFact(&queryReferences{Names: names})
+	}
+	if reportUnused {
+		for _, fact := range pass.AllPackageFacts() {
+			for _, name := range fact.Fact.(*queryReferences).Names {
+				referenced[name] = true
+			}
+		}
+		if unusedIn == "" && len(referenced) == 0 {
+			// a main package that references no queries is a separate program, such as a tool, whose queries are unrelated
+			return nil, nil
+		}
+	}
+	queries, err := loadQueries(moduleRoot(pass))
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range references {
+		if _, ok := queries[ref.name]; !ok {
+			pass.Reportf(ref.arg.Pos(), "undefined named query %v", ref.name)
+		}
+	}
+	if reportUnused {
+		unused := make([]string, 0, len(queries))
+		for name := range queries {
+			if !referenced[name] {
+				unused = append(unused, name)
+			}
+		}
+		sort.Strings(unused)
+		for _, name := range unused {
+			pass.Reportf(pass.Files[0].Name.Pos(), "named query %v defined at %v is never used", name, queries[name].Source)
+		}
+	}
+	return nil, nil
+}
+
+// queryNameArg returns the query name argument of a call to a dbx method that looks up a named query, or nil if the call is not such a lookup.
+func queryNameArg(pass *analysis.Pass, call *ast.CallExpr) ast.Expr {
+	selector, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	fn, ok := pass.TypesInfo.Uses[selector.Sel].(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != dbxPath {
+		return nil
+	}
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return nil
+	}
+	recvType := recv.Type()
+	if pointer, ok := recvType.(*types.Pointer); ok {
+		recvType = pointer.Elem()
+	}
+	named, ok := recvType.(*types.Named)
+	if !ok {
+		return nil
+	}
+	index, ok := lookupMethods[named.Obj().Name()+"."+fn.Name()]
+	if !ok || index >= len(call.Args) {
+		return nil
+	}
+	return call.Args[index]
+}
+
+// isUnusedIn reports whether the package is named by the -unused-in flag.
+func isUnusedIn(pkg *types.Package) bool {
+	for _, path := range strings.Split(unusedIn, ",") {
+		if path = strings.TrimSpace(path); path != "" && path == pkg.Path() {
+			return true
+		}
+	}
+	return false
+}
+
+// isMain reports whether the package is a main package, excluding generated test main packages.
+func isMain(pkg *types.Package) bool {
+	return pkg.Name() == "main" && !strings.HasSuffix(pkg.Path(), ".test")
+}
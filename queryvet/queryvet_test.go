@@ -0,0 +1,46 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queryvet
+
+import (
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	// given
+	pattern, err := filepath.Abs("testdata/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Analyzer.Flags.Set("queries", pattern); err != nil {
+		t.Fatal(err)
+	}
+
+	// then
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "users", "app")
+}
+
+func TestAnalyzerResolvesPatternsAgainstModuleRoot(t *testing.T) {
+	// given
+	if err := Analyzer.Flags.Set("queries", "db/queries/*.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	// then
+	analysistest.Run(t, filepath.Join(analysistest.TestData(), "mod"), Analyzer, "./...")
+}
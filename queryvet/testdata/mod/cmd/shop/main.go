@@ -0,0 +1,13 @@
+package main // want package:`queryReferences\(InsertOrder\)` `named query CancelOrder defined at .*db/queries/queries.json:4 is never used`
+
+import (
+	"github.com/dakiva/dbx"
+
+	"example.com/shop/internal/orders"
+)
+
+func main() {
+	queries := dbx.QueryMap{}
+	orders.Find(queries)
+	queries.Q("InsertOrder")
+}
@@ -0,0 +1,13 @@
+package dbx
+
+type QueryMap map[string]string
+
+func (q QueryMap) Q(name string) string {
+	return q[name]
+}
+
+type QueryRegistry struct{}
+
+func (r *QueryRegistry) Q(name string) string {
+	return ""
+}
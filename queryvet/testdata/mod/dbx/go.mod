@@ -0,0 +1,3 @@
+module github.com/dakiva/dbx
+
+go 1.22
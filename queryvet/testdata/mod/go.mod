@@ -0,0 +1,7 @@
+module example.com/shop
+
+go 1.22
+
+require github.com/dakiva/dbx v0.0.0
+
+replace github.com/dakiva/dbx => ./dbx
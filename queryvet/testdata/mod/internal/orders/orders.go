@@ -0,0 +1,8 @@
+package orders // want package:`queryReferences\(FindOrder, FindOrdr\)`
+
+import "github.com/dakiva/dbx"
+
+func Find(queries dbx.QueryMap) {
+	queries.Q("FindOrder")
+	queries.Q("FindOrdr") // want `undefined named query FindOrdr`
+}
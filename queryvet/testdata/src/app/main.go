@@ -0,0 +1,13 @@
+package main // want package:`queryReferences\(ListUsers\)` `named query DeleteUser defined at .*testdata/queries.json:5 is never used` `named query InsertUser defined at .*testdata/queries.json:3 is never used`
+
+import (
+	"github.com/dakiva/dbx"
+
+	"users"
+)
+
+func main() {
+	queries := dbx.QueryMap{}
+	users.Find(queries, nil, "")
+	queries.Q("ListUsers")
+}
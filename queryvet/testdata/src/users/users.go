@@ -0,0 +1,18 @@
+package users // want package:`queryReferences\(FindUser, InsertUsr, users.FindByEmail\)`
+
+import "github.com/dakiva/dbx"
+
+type QueryIdentifier string
+
+const (
+	FindUser    QueryIdentifier = "FindUser"
+	InsertUsr                   = "InsertUsr"
+	findByEmail                 = "users." + "FindByEmail"
+)
+
+func Find(queries dbx.QueryMap, registry *dbx.QueryRegistry, name string) {
+	queries.Q(string(FindUser))
+	queries.Q(InsertUsr) // want `undefined named query InsertUsr`
+	registry.Q(findByEmail)
+	queries.Q(name)
+}
@@ -0,0 +1,252 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// DefaultReplicaHealthCheckInterval is the interval between replica health checks when ReplicaProviderOptions.HealthCheckInterval is not set.
+	DefaultReplicaHealthCheckInterval = 5 * time.Second
+	// DefaultReplicaHealthCheckTimeout bounds each replica health check when ReplicaProviderOptions.HealthCheckTimeout is not set.
+	DefaultReplicaHealthCheckTimeout = time.Second
+)
+
+var _ PgTxContextProvider = (*ReplicaProvider)(nil)
+
+// ReplicaBalancing selects how a ReplicaProvider spreads reads across its healthy replicas.
+type ReplicaBalancing int
+
+const (
+	// RoundRobin reads from each healthy replica in turn.
+	RoundRobin ReplicaBalancing = iota
+	// LeastConnections reads from the healthy replica with the fewest connections in use, taking replicas in turn when tied.
+	LeastConnections
+)
+
+// ReplicaProviderOptions configures a ReplicaProvider. Zero valued fields take their defaults.
+type ReplicaProviderOptions struct {
+	// Balancing selects how reads are spread across the healthy replicas.
+	Balancing ReplicaBalancing
+	// HealthCheckInterval is the interval at which every replica is pinged to determine whether it is healthy.
+	HealthCheckInterval time.Duration
+	// HealthCheckTimeout bounds each ping, after which the replica is considered unhealthy.
+	HealthCheckTimeout time.Duration
+	// OnHealthChange, if set, is called whenever a replica becomes healthy or unhealthy.
+	OnHealthChange func(ReplicaHealthEvent)
+}
+
+// ReplicaHealthEvent describes a change in the health of a replica.
+type ReplicaHealthEvent struct {
+	// Replica is the position of the replica in the list of replicas given to the provider.
+	Replica int
+	// Healthy is true if the replica became healthy, and false if it became unhealthy.
+	Healthy bool
+	// Err holds the error returned by the failed health check of an unhealthy replica.
+	Err error
+	// Time is when the health check completed.
+	Time time.Time
+}
+
+// ReplicaProvider is a PgTxContextProvider that splits reads from writes. GetContext returns one of the healthy replicas, falling back to the primary when no replica is healthy, while transactions always run on the primary. The health of every replica is checked when the provider is created, then periodically until Close is called.
+type ReplicaProvider struct {
+	primary   *DBProvider
+	replicas  []*replica
+	options   ReplicaProviderOptions
+	next      atomic.Uint64
+	owned     []*sqlx.DB
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// replica is a replica database along with the outcome of its last health check.
+type replica struct {
+	db      *sqlx.DB
+	healthy atomic.Bool
+}
+
+// NewReplicaProvider returns a provider that runs transactions on primary and reads from replicas. The databases are not closed when the provider is closed.
+func NewReplicaProvider(primary *sqlx.DB, replicas []*sqlx.DB, opts ReplicaProviderOptions) *ReplicaProvider {
+	if opts.HealthCheckInterval <= 0 {
+		opts.HealthCheckInterval = DefaultReplicaHealthCheckInterval
+	}
+	if opts.HealthCheckTimeout <= 0 {
+		opts.HealthCheckTimeout = DefaultReplicaHealthCheckTimeout
+	}
+	p := &ReplicaProvider{
+		primary: NewDBProvider(primary),
+		options: opts,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	for _, db := range replicas {
+		p.replicas = append(p.replicas, &replica{db: db})
+	}
+	p.CheckHealth()
+	go p.watch()
+	return p
+}
+
+// OpenReplicaProvider connects to the Postgres primary and opens the Postgres replicas given by their data source names, returning a provider that runs transactions on the primary and reads from the replicas. A replica that cannot be reached is considered unhealthy, rather than failing the call. The databases are closed when the provider is closed.
+func OpenReplicaProvider(primaryDSN string, replicaDSNs []string, opts ReplicaProviderOptions) (*ReplicaProvider, error) {
+	primary, err := sqlx.Connect(PostgresType, primaryDSN)
+	if err != nil {
+		return nil, err
+	}
+	owned := []*sqlx.DB{primary}
+	for _, dsn := range replicaDSNs {
+		db, err := sqlx.Open(PostgresType, dsn)
+		if err != nil {
+			closeAll(owned)
+			return nil, err
+		}
+		owned = append(owned, db)
+	}
+	p := NewReplicaProvider(primary, owned[1:], opts)
+	p.owned = owned
+	return p, nil
+}
+
+// GetContext returns a healthy replica, chosen using the configured balancing, or the primary if no replica is healthy.
+func (p *ReplicaProvider) GetContext() (DBContext, error) {
+	if r := p.pick(); r != nil {
+		return r.db, nil
+	}
+	return p.primary.GetContext()
+}
+
+// GetTxContext begins a transaction on the primary using the default isolation level and access mode.
+func (p *ReplicaProvider) GetTxContext() (DBTxContext, error) {
+	return p.primary.GetTxContext()
+}
+
+// BeginTxContext begins a transaction on the primary using opts, which may be nil to use the defaults.
+func (p *ReplicaProvider) BeginTxContext(ctx context.Context, opts *sql.TxOptions) (DBTxContext, error) {
+	return p.primary.BeginTxContext(ctx, opts)
+}
+
+// GetPgTxContext begins a transaction on the primary, applying the Postgres specific settings of opts as described by DBProvider.GetPgTxContext.
+func (p *ReplicaProvider) GetPgTxContext(ctx context.Context, opts PgTxOptions) (DBTxContext, error) {
+	return p.primary.GetPgTxContext(ctx, opts)
+}
+
+// CheckHealth pings every replica, updating its health, in addition to the periodic health checks. OnHealthChange is called once every replica has been checked, in the order of the replicas.
+func (p *ReplicaProvider) CheckHealth() {
+	events := make([]*ReplicaHealthEvent, len(p.replicas))
+	var wg sync.WaitGroup
+	for i, r := range p.replicas {
+		wg.Add(1)
+		go func(i int, r *replica) {
+			defer wg.Done()
+			events[i] = p.checkReplica(i, r)
+		}(i, r)
+	}
+	wg.Wait()
+	if p.options.OnHealthChange == nil {
+		return
+	}
+	for _, e := range events {
+		if e != nil {
+			p.options.OnHealthChange(*e)
+		}
+	}
+}
+
+// Close stops the health checks, closing the databases if they were opened by OpenReplicaProvider.
+func (p *ReplicaProvider) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		close(p.stop)
+		<-p.done
+		err = closeAll(p.owned)
+	})
+	return err
+}
+
+// pick returns a healthy replica chosen using the configured balancing, or nil if no replica is healthy.
+func (p *ReplicaProvider) pick() *replica {
+	n := len(p.replicas)
+	if n == 0 {
+		return nil
+	}
+	start := int((p.next.Add(1) - 1) % uint64(n))
+	var picked *replica
+	inUse := 0
+	for i := 0; i < n; i++ {
+		r := p.replicas[(start+i)%n]
+		if !r.healthy.Load() {
+			continue
+		}
+		if p.options.Balancing != LeastConnections {
+			return r
+		}
+		if count := r.db.Stats().InUse; picked == nil || count < inUse {
+			picked, inUse = r, count
+		}
+	}
+	return picked
+}
+
+// checkReplica pings a replica, returning an event describing any change in its health, or nil if its health is unchanged.
+func (p *ReplicaProvider) checkReplica(i int, r *replica) *ReplicaHealthEvent {
+	ctx, cancel := context.WithTimeout(context.Background(), p.options.HealthCheckTimeout)
+	defer cancel()
+	err := r.db.PingContext(ctx)
+	healthy := err == nil
+	if r.healthy.Swap(healthy) == healthy {
+		return nil
+	}
+	return &ReplicaHealthEvent{
+		Replica: i,
+		Healthy: healthy,
+		Err:     err,
+		Time:    time.Now(),
+	}
+}
+
+// watch checks the health of the replicas at the configured interval until the provider is closed.
+func (p *ReplicaProvider) watch() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.options.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.CheckHealth()
+		}
+	}
+}
+
+// closeAll closes every database, returning the errors joined together.
+func closeAll(dbs []*sqlx.DB) error {
+	var errs []error
+	for _, db := range dbs {
+		if err := db.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,196 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+// pingDriver is a database driver whose connections only support pinging, failing for data source names marked as down.
+type pingDriver struct {
+	mu   sync.Mutex
+	down map[string]bool
+}
+
+type pingConn struct {
+	driver *pingDriver
+	dsn    string
+}
+
+func (d *pingDriver) Open(dsn string) (driver.Conn, error) {
+	return &pingConn{driver: d, dsn: dsn}, nil
+}
+
+func (d *pingDriver) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.down = map[string]bool{}
+}
+
+func (d *pingDriver) setDown(dsn string, down bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.down[dsn] = down
+}
+
+func (c *pingConn) Ping(ctx context.Context) error {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+	if c.driver.down[c.dsn] {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c *pingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *pingConn) Close() error {
+	return nil
+}
+
+func (c *pingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+var testPingDriver = &pingDriver{down: map[string]bool{}}
+
+func init() {
+	sql.Register("dbxping", testPingDriver)
+}
+
+func openPingDB(t *testing.T, dsn string) *sqlx.DB {
+	t.Cleanup(testPingDriver.reset)
+	db, err := sqlx.Open("dbxping", dsn)
+	assert.NoError(t, err)
+	return db
+}
+
+func TestReplicaProviderRoundRobin(t *testing.T) {
+	// given
+	primary := openPingDB(t, "primary")
+	replicas := []*sqlx.DB{openPingDB(t, "rr1"), openPingDB(t, "rr2"), openPingDB(t, "rr3")}
+	testPingDriver.setDown("rr2", true)
+	var events []ReplicaHealthEvent
+	provider := NewReplicaProvider(primary, replicas, ReplicaProviderOptions{
+		OnHealthChange: func(e ReplicaHealthEvent) { events = append(events, e) },
+	})
+	defer provider.Close()
+
+	// when
+	var reads []DBContext
+	for i := 0; i < 4; i++ {
+		db, err := provider.GetContext()
+		assert.NoError(t, err)
+		reads = append(reads, db)
+	}
+
+	// then
+	assert.Equal(t, []DBContext{replicas[0], replicas[2], replicas[2], replicas[0]}, reads)
+	assert.Len(t, events, 2)
+
+	// when every replica is down
+	events = nil
+	testPingDriver.setDown("rr1", true)
+	testPingDriver.setDown("rr3", true)
+	provider.CheckHealth()
+	fallback, err := provider.GetContext()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, primary, fallback)
+	assert.Len(t, events, 2)
+	for _, e := range events {
+		assert.False(t, e.Healthy)
+		assert.Error(t, e.Err)
+	}
+
+	// when a replica recovers
+	testPingDriver.setDown("rr2", false)
+	provider.CheckHealth()
+	recovered, err := provider.GetContext()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, replicas[1], recovered)
+}
+
+func TestReplicaProviderRoundRobinWraps(t *testing.T) {
+	// given
+	primary := openPingDB(t, "primary")
+	replicas := []*sqlx.DB{openPingDB(t, "wrap1"), openPingDB(t, "wrap2"), openPingDB(t, "wrap3")}
+	provider := NewReplicaProvider(primary, replicas, ReplicaProviderOptions{})
+	defer provider.Close()
+	provider.next.Store(math.MaxUint64 - 1)
+
+	// when
+	var reads []DBContext
+	for i := 0; i < 3; i++ {
+		db, err := provider.GetContext()
+		assert.NoError(t, err)
+		reads = append(reads, db)
+	}
+
+	// then
+	assert.Equal(t, []DBContext{replicas[2], replicas[0], replicas[0]}, reads)
+}
+
+func TestReplicaProviderLeastConnections(t *testing.T) {
+	// given
+	primary := openPingDB(t, "primary")
+	replicas := []*sqlx.DB{openPingDB(t, "lc1"), openPingDB(t, "lc2")}
+	provider := NewReplicaProvider(primary, replicas, ReplicaProviderOptions{Balancing: LeastConnections})
+	defer provider.Close()
+	conn, err := replicas[0].Conn(context.Background())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	// when
+	var reads []DBContext
+	for i := 0; i < 2; i++ {
+		db, err := provider.GetContext()
+		assert.NoError(t, err)
+		reads = append(reads, db)
+	}
+
+	// then
+	assert.Equal(t, []DBContext{replicas[1], replicas[1]}, reads)
+}
+
+func TestReplicaProviderWithoutReplicas(t *testing.T) {
+	// given
+	primary := openPingDB(t, "primary")
+	provider := NewReplicaProvider(primary, nil, ReplicaProviderOptions{})
+
+	// when
+	db, err := provider.GetContext()
+	closeErr := provider.Close()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, primary, db)
+	assert.NoError(t, closeErr)
+	assert.NoError(t, provider.Close())
+}
@@ -0,0 +1,198 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrActiveSavepoint is returned when a transaction is committed before a transaction nested within it has ended.
+	ErrActiveSavepoint = errors.New("nested transaction has not ended")
+	// ErrNestedTxUnsupported is returned by BeginNested when a transaction context is unable to begin nested transactions.
+	ErrNestedTxUnsupported = errors.New("nested transactions are not supported by the transaction context")
+)
+
+// BeginNested begins a transaction nested within tx, such as a transaction context passed to the function run by RunInTx, returning ErrNestedTxUnsupported if tx is not a NestedTxContext.
+func BeginNested(tx DBTxContext) (NestedTxContext, error) {
+	nested, ok := tx.(NestedTxContext)
+	if !ok {
+		return nil, ErrNestedTxUnsupported
+	}
+	return nested.Begin()
+}
+
+// savepointStack tracks the savepoints of the nested transactions of a transaction, innermost last.
+type savepointStack struct {
+	mu     sync.Mutex
+	active []string
+	count  int
+}
+
+// begin establishes a new savepoint within tx, returning a transaction context for it.
+func (s *savepointStack) begin(tx *txContext) (NestedTxContext, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	name := fmt.Sprintf("dbx_savepoint_%d", s.count)
+	if _, err := tx.Tx.Exec("SAVEPOINT " + name); err != nil {
+		return nil, err
+	}
+	s.active = append(s.active, name)
+	return &savepoint{tx: tx, name: name}, nil
+}
+
+// end releases the named savepoint, first rolling back to it if rollback is set. Unless the savepoint is being rolled back, which also rolls back the savepoints established after it, every savepoint established after it must already have ended.
+func (s *savepointStack) end(tx *txContext, name string, rollback bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(name)
+	if i < 0 {
+		return endedSavepointError(name)
+	}
+	if !rollback && i < len(s.active)-1 {
+		return fmt.Errorf("%w: %v within %v", ErrActiveSavepoint, s.active[len(s.active)-1], name)
+	}
+	if rollback {
+		if _, err := tx.Tx.Exec("ROLLBACK TO SAVEPOINT " + name); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Tx.Exec("RELEASE SAVEPOINT " + name); err != nil {
+		return err
+	}
+	s.active = s.active[:i]
+	return nil
+}
+
+// check returns an error if the named savepoint has ended.
+func (s *savepointStack) check(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index(name) < 0 {
+		return endedSavepointError(name)
+	}
+	return nil
+}
+
+// checkEnded returns an error matching ErrActiveSavepoint if any savepoint has not ended.
+func (s *savepointStack) checkEnded() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.active) > 0 {
+		return fmt.Errorf("%w: %v", ErrActiveSavepoint, s.active[len(s.active)-1])
+	}
+	return nil
+}
+
+// clear ends every savepoint, as when the transaction is rolled back.
+func (s *savepointStack) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active = nil
+}
+
+// index returns the position of the named savepoint, or -1 if it has ended.
+func (s *savepointStack) index(name string) int {
+	for i, active := range s.active {
+		if active == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// endedSavepointError reports the use of a nested transaction that has ended, matching sql.ErrTxDone.
+func endedSavepointError(name string) error {
+	return fmt.Errorf("%v: %w", name, sql.ErrTxDone)
+}
+
+// savepoint is a nested transaction backed by a savepoint. Commit releases the savepoint, while Rollback rolls back to it before releasing it.
+type savepoint struct {
+	tx   *txContext
+	name string
+}
+
+// NamedExec executes a query that contains named query parameters within the nested transaction, returning result metadata or an error.
+func (s *savepoint) NamedExec(query string, arg interface{}) (sql.Result, error) {
+	if err := s.tx.savepoints.check(s.name); err != nil {
+		return nil, err
+	}
+	return s.tx.NamedExec(query, arg)
+}
+
+// NamedQuery executes a query that contains named parameters within the nested transaction, returning rows returned by the database or an error.
+func (s *savepoint) NamedQuery(query string, arg interface{}) (*sqlx.Rows, error) {
+	if err := s.tx.savepoints.check(s.name); err != nil {
+		return nil, err
+	}
+	return s.tx.NamedQuery(query, arg)
+}
+
+// PrepareNamed prepares a query with named parameters within the nested transaction, returning a prepared statement or an error.
+func (s *savepoint) PrepareNamed(query string) (*sqlx.NamedStmt, error) {
+	if err := s.tx.savepoints.check(s.name); err != nil {
+		return nil, err
+	}
+	return s.tx.PrepareNamed(query)
+}
+
+// NamedExecContext executes a query that contains named query parameters within the nested transaction, returning result metadata or an error.
+func (s *savepoint) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	if err := s.tx.savepoints.check(s.name); err != nil {
+		return nil, err
+	}
+	return s.tx.NamedExecContext(ctx, query, arg)
+}
+
+// NamedQueryContext executes a query that contains named parameters within the nested transaction, returning rows returned by the database or an error.
+func (s *savepoint) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sqlx.Rows, error) {
+	if err := s.tx.savepoints.check(s.name); err != nil {
+		return nil, err
+	}
+	return s.tx.NamedQueryContext(ctx, query, arg)
+}
+
+// PrepareNamedContext prepares a query with named parameters within the nested transaction, returning a prepared statement or an error.
+func (s *savepoint) PrepareNamedContext(ctx context.Context, query string) (*sqlx.NamedStmt, error) {
+	if err := s.tx.savepoints.check(s.name); err != nil {
+		return nil, err
+	}
+	return s.tx.PrepareNamedContext(ctx, query)
+}
+
+// Commit releases the savepoint, or returns an error matching ErrActiveSavepoint if a transaction nested within it has not ended.
+func (s *savepoint) Commit() error {
+	return s.tx.savepoints.end(s.tx, s.name, false)
+}
+
+// Rollback rolls back to the savepoint and releases it, undoing the work done within it and ending any transactions nested within it.
+func (s *savepoint) Rollback() error {
+	return s.tx.savepoints.end(s.tx, s.name, true)
+}
+
+// Begin begins a transaction nested within this one, backed by a new savepoint.
+func (s *savepoint) Begin() (NestedTxContext, error) {
+	if err := s.tx.savepoints.check(s.name); err != nil {
+		return nil, err
+	}
+	return s.tx.savepoints.begin(s.tx)
+}
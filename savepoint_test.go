@@ -0,0 +1,159 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// execDriver is a database driver whose connections record the statements executed within their transactions.
+type execDriver struct {
+	mu         sync.Mutex
+	statements []string
+}
+
+type execConn struct {
+	driver *execDriver
+}
+
+func (d *execDriver) Open(dsn string) (driver.Conn, error) {
+	return &execConn{driver: d}, nil
+}
+
+func (d *execDriver) executed() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.statements
+}
+
+func (c *execConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+	c.driver.statements = append(c.driver.statements, query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *execConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *execConn) Close() error {
+	return nil
+}
+
+func (c *execConn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *execConn) Commit() error {
+	return nil
+}
+
+func (c *execConn) Rollback() error {
+	return nil
+}
+
+var testExecDriver = &execDriver{}
+
+func init() {
+	sql.Register("dbxexec", testExecDriver)
+}
+
+func TestNestedTransactionStatements(t *testing.T) {
+	// given
+	db, err := sqlx.Open("dbxexec", "")
+	require.NoError(t, err)
+	defer db.Close()
+	sqlTx, err := db.Beginx()
+	require.NoError(t, err)
+	tx := NewTxContext(sqlTx)
+
+	// when
+	committed, committedErr := BeginNested(tx)
+	commitErr := committed.Commit()
+	rolledBack, rolledBackErr := BeginNested(tx)
+	rollbackErr := rolledBack.Rollback()
+	txErr := tx.Commit()
+
+	// then
+	assert.NoError(t, committedErr)
+	assert.NoError(t, commitErr)
+	assert.NoError(t, rolledBackErr)
+	assert.NoError(t, rollbackErr)
+	assert.NoError(t, txErr)
+	assert.Equal(t, []string{
+		"SAVEPOINT dbx_savepoint_1",
+		"RELEASE SAVEPOINT dbx_savepoint_1",
+		"SAVEPOINT dbx_savepoint_2",
+		"ROLLBACK TO SAVEPOINT dbx_savepoint_2",
+		"RELEASE SAVEPOINT dbx_savepoint_2",
+	}, testExecDriver.executed())
+}
+
+func TestBeginNestedUnsupported(t *testing.T) {
+	// when
+	_, err := BeginNested(&recordingContext{})
+
+	// then
+	assert.Equal(t, ErrNestedTxUnsupported, err)
+}
+
+func TestNestedTransactions(t *testing.T) {
+	// given
+	db := setupTestDB(t, GenerateSchemaName("savepointschema"))
+	ctx := context.Background()
+	insert := func(tx DBTxContext, value int) {
+		_, err := tx.NamedExecContext(ctx, "INSERT INTO test (ColA) VALUES (:cola)", map[string]interface{}{"cola": value})
+		assert.NoError(t, err)
+	}
+	sqlTx, err := db.BeginTxx(ctx, nil)
+	assert.NoError(t, err)
+	tx := NewTxContext(sqlTx)
+
+	// when
+	insert(tx, 200)
+	parent, parentErr := tx.Begin()
+	insert(parent, 300)
+	child, childErr := parent.Begin()
+	insert(child, 400)
+	parentCommitErr := parent.Commit()
+	txCommitErr := tx.Commit()
+	childRollbackErr := child.Rollback()
+	_, endedErr := child.NamedExecContext(ctx, "INSERT INTO test (ColA) VALUES (500)", nil)
+	parentReleaseErr := parent.Commit()
+	commitErr := tx.Commit()
+
+	// then
+	assert.NoError(t, parentErr)
+	assert.NoError(t, childErr)
+	assert.True(t, errors.Is(parentCommitErr, ErrActiveSavepoint))
+	assert.True(t, errors.Is(txCommitErr, ErrActiveSavepoint))
+	assert.NoError(t, childRollbackErr)
+	assert.True(t, errors.Is(endedErr, sql.ErrTxDone))
+	assert.NoError(t, parentReleaseErr)
+	assert.NoError(t, commitErr)
+	var values []int64
+	assert.NoError(t, NamedSelect(ctx, db, &values, "SELECT ColA FROM test ORDER BY ColA", nil))
+	assert.Equal(t, []int64{100, 200, 300}, values)
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	_ DBContext       = (*sqlx.DB)(nil)
+	_ NestedTxContext = (*txContext)(nil)
+	_ NestedTxContext = (*savepoint)(nil)
+)
+
+// txContext adapts a *sqlx.Tx, which lacks a NamedQueryContext method, to NestedTxContext, tracking the savepoints of nested transactions.
+type txContext struct {
+	*sqlx.Tx
+	savepoints savepointStack
+}
+
+// NewTxContext adapts a sqlx transaction to a NestedTxContext. Nested transactions begun with Begin are backed by savepoints.
+func NewTxContext(tx *sqlx.Tx) NestedTxContext {
+	return &txContext{Tx: tx}
+}
+
+// Commit commits the transaction, or returns an error matching ErrActiveSavepoint, without committing, if a nested transaction has not ended.
+func (t *txContext) Commit() error {
+	if err := t.savepoints.checkEnded(); err != nil {
+		return err
+	}
+	return t.Tx.Commit()
+}
+
+// Rollback rolls back the transaction, along with any nested transactions that have not ended.
+func (t *txContext) Rollback() error {
+	t.savepoints.clear()
+	return t.Tx.Rollback()
+}
+
+// Begin begins a nested transaction backed by a savepoint.
+func (t *txContext) Begin() (NestedTxContext, error) {
+	return t.savepoints.begin(t)
+}
+
+// NamedQueryContext executes a query that contains named parameters within the transaction, returning rows returned by the database or an error.
+func (t *txContext) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sqlx.Rows, error) {
+	return sqlx.NamedQueryContext(ctx, t.Tx, query, arg)
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxContext(t *testing.T) {
+	// given
+	db := setupTestDB(t, GenerateSchemaName("txcontextschema"))
+	ctx := context.Background()
+	tx, err := db.BeginTxx(ctx, nil)
+	assert.NoError(t, err)
+	txContext := NewTxContext(tx)
+
+	// when
+	_, execErr := txContext.NamedExecContext(ctx, "INSERT INTO test (ColA) VALUES (:cola)", map[string]interface{}{"cola": 200})
+	rows, queryErr := txContext.NamedQueryContext(ctx, "SELECT ColA FROM test WHERE ColA = :cola", map[string]interface{}{"cola": 200})
+
+	// then
+	assert.NoError(t, execErr)
+	assert.NoError(t, queryErr)
+	assert.True(t, rows.Next())
+	assert.NoError(t, rows.Close())
+	assert.NoError(t, txContext.Rollback())
+
+	// when the context is cancelled
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, cancelledErr := db.NamedExecContext(cancelled, "INSERT INTO test (ColA) VALUES (:cola)", map[string]interface{}{"cola": 300})
+
+	// then
+	assert.Equal(t, context.Canceled, cancelledErr)
+}
@@ -0,0 +1,309 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// DefaultStmtCacheCapacity is the number of prepared statements a StmtCache holds when no capacity is given.
+const DefaultStmtCacheCapacity = 100
+
+// ErrStmtCacheClosed is returned when a closed StmtCache is used.
+var ErrStmtCacheClosed = errors.New("statement cache is closed")
+
+// StmtCache prepares each named query once per connection pool and reuses the prepared statement for later executions. The least recently used statement is closed once the cache exceeds its capacity. A StmtCache is safe for concurrent use.
+type StmtCache struct {
+	db       *sqlx.DB
+	queries  QueryMap
+	capacity int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	closed  bool
+	// preparing holds a channel for each query being prepared, closed once the statement is prepared or preparation fails
+	preparing map[string]chan struct{}
+}
+
+// cachedStmt is a prepared statement held by the cache. A statement that is evicted while in use is closed once it is released by every user.
+type cachedStmt struct {
+	name    string
+	stmt    *sqlx.NamedStmt
+	refs    int
+	evicted bool
+}
+
+// NewStmtCache returns a cache preparing the queries of the query map against db, holding at most capacity statements. A capacity less than one uses DefaultStmtCacheCapacity.
+func NewStmtCache(db *sqlx.DB, queries QueryMap, capacity int) *StmtCache {
+	if capacity < 1 {
+		capacity = DefaultStmtCacheCapacity
+	}
+	return &StmtCache{
+		db:        db,
+		queries:   queries,
+		capacity:  capacity,
+		entries:   make(map[string]*list.Element),
+		lru:       list.New(),
+		preparing: make(map[string]chan struct{}),
+	}
+}
+
+// NamedExecContext executes the named query using its cached prepared statement, returning result metadata or an error. If Postgres reports that the cached plan is no longer valid, such as after a migration changed a table the query reads, the statement is prepared again and the query retried once.
+func (c *StmtCache) NamedExecContext(ctx context.Context, name string, arg interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := c.withRetry(ctx, name, func(stmt *sqlx.NamedStmt) error {
+		var err error
+		result, err = stmt.ExecContext(ctx, namedArg(arg))
+		return err
+	})
+	return result, err
+}
+
+// NamedQueryContext executes the named query using its cached prepared statement, returning the rows returned by the database or an error. Invalid cached plans are handled as described by NamedExecContext.
+func (c *StmtCache) NamedQueryContext(ctx context.Context, name string, arg interface{}) (*sqlx.Rows, error) {
+	var rows *sqlx.Rows
+	err := c.withRetry(ctx, name, func(stmt *sqlx.NamedStmt) error {
+		var err error
+		rows, err = stmt.QueryxContext(ctx, namedArg(arg))
+		return err
+	})
+	return rows, err
+}
+
+// Tx returns a cache of statements for use within the transaction. Each named query is re-prepared on the transaction at most once, from the statement cached for the pool, using Tx.NamedStmt. The returned cache must be closed once the transaction completes.
+func (c *StmtCache) Tx(tx *sqlx.Tx) *TxStmtCache {
+	return &TxStmtCache{cache: c, tx: tx, stmts: make(map[string]*sqlx.NamedStmt)}
+}
+
+// Len returns the number of statements held by the cache.
+func (c *StmtCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Close closes every cached statement. Statements in use are closed once released. Any later use of the cache returns ErrStmtCacheClosed.
+func (c *StmtCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	var err error
+	for c.lru.Len() > 0 {
+		if closeErr := c.evict(c.lru.Back()); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// withRetry invokes fn with the prepared statement of the named query, preparing the statement again and retrying once if the cached plan is no longer valid.
+func (c *StmtCache) withRetry(ctx context.Context, name string, fn func(*sqlx.NamedStmt) error) error {
+	err := c.with(ctx, name, fn)
+	if isCachedPlanError(err) {
+		c.invalidate(name)
+		err = c.with(ctx, name, fn)
+	}
+	if err != nil {
+		return newQueryError(name, err)
+	}
+	return nil
+}
+
+// with invokes fn with the prepared statement of the named query, holding the statement until fn returns.
+func (c *StmtCache) with(ctx context.Context, name string, fn func(*sqlx.NamedStmt) error) error {
+	entry, err := c.acquire(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer c.release(entry)
+	return fn(entry.stmt)
+}
+
+// acquire returns the cached statement of the named query, preparing it if necessary. The statement must be released once no longer used. Statements are prepared without holding the cache lock, so a slow prepare only delays the callers waiting on the same query, which use the statement once it is prepared rather than preparing it twice.
+func (c *StmtCache) acquire(ctx context.Context, name string) (*cachedStmt, error) {
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return nil, ErrStmtCacheClosed
+		}
+		if element, ok := c.entries[name]; ok {
+			c.lru.MoveToFront(element)
+			entry := element.Value.(*cachedStmt)
+			entry.refs++
+			c.mu.Unlock()
+			return entry, nil
+		}
+		if done, ok := c.preparing[name]; ok {
+			c.mu.Unlock()
+			// a failed prepare leaves no statement behind, in which case the loop prepares the query again
+			select {
+			case <-done:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		value, err := c.queries.lookup(name)
+		if err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		done := make(chan struct{})
+		c.preparing[name] = done
+		c.mu.Unlock()
+		return c.prepare(ctx, name, value.Query, done)
+	}
+}
+
+// prepare prepares the named query, adding the statement to the cache and notifying the callers waiting on done.
+func (c *StmtCache) prepare(ctx context.Context, name, query string, done chan struct{}) (*cachedStmt, error) {
+	stmt, err := c.db.PrepareNamedContext(ctx, query)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.preparing, name)
+	close(done)
+	if err != nil {
+		return nil, err
+	}
+	if c.closed {
+		stmt.Close()
+		return nil, ErrStmtCacheClosed
+	}
+	entry := &cachedStmt{name: name, stmt: stmt, refs: 1}
+	c.entries[name] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.capacity {
+		c.evict(c.lru.Back())
+	}
+	return entry, nil
+}
+
+// release releases a statement obtained from acquire, closing it if it was evicted while in use.
+func (c *StmtCache) release(entry *cachedStmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.refs--
+	if entry.evicted && entry.refs == 0 {
+		entry.stmt.Close()
+	}
+}
+
+// invalidate evicts the statement of the named query so that the next use prepares it again.
+func (c *StmtCache) invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[name]; ok {
+		c.evict(element)
+	}
+}
+
+// evict removes an element from the cache, closing its statement unless it is in use. The cache lock must be held.
+func (c *StmtCache) evict(element *list.Element) error {
+	entry := c.lru.Remove(element).(*cachedStmt)
+	delete(c.entries, entry.name)
+	entry.evicted = true
+	if entry.refs == 0 {
+		return entry.stmt.Close()
+	}
+	return nil
+}
+
+// TxStmtCache holds the statements prepared on a single transaction. It is not safe for concurrent use, as a transaction is not.
+type TxStmtCache struct {
+	cache   *StmtCache
+	tx      *sqlx.Tx
+	stmts   map[string]*sqlx.NamedStmt
+	entries []*cachedStmt
+}
+
+// NamedExecContext executes the named query within the transaction, returning result metadata or an error. An invalid cached plan aborts the transaction, so it is not retried, however the pool statement is evicted so that a retried transaction prepares the query again.
+func (t *TxStmtCache) NamedExecContext(ctx context.Context, name string, arg interface{}) (sql.Result, error) {
+	stmt, err := t.stmt(ctx, name)
+	if err != nil {
+		return nil, newQueryError(name, err)
+	}
+	result, err := stmt.ExecContext(ctx, namedArg(arg))
+	if err != nil {
+		return nil, t.queryError(name, err)
+	}
+	return result, nil
+}
+
+// NamedQueryContext executes the named query within the transaction, returning the rows returned by the database or an error. Invalid cached plans are handled as described by NamedExecContext.
+func (t *TxStmtCache) NamedQueryContext(ctx context.Context, name string, arg interface{}) (*sqlx.Rows, error) {
+	stmt, err := t.stmt(ctx, name)
+	if err != nil {
+		return nil, newQueryError(name, err)
+	}
+	rows, err := stmt.QueryxContext(ctx, namedArg(arg))
+	if err != nil {
+		return nil, t.queryError(name, err)
+	}
+	return rows, nil
+}
+
+// Close closes the statements prepared on the transaction and releases the pool statements they were prepared from.
+func (t *TxStmtCache) Close() error {
+	var err error
+	for name, stmt := range t.stmts {
+		if closeErr := stmt.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		delete(t.stmts, name)
+	}
+	for _, entry := range t.entries {
+		t.cache.release(entry)
+	}
+	t.entries = nil
+	return err
+}
+
+// stmt returns the statement of the named query prepared on the transaction, preparing it from the pool statement if necessary.
+func (t *TxStmtCache) stmt(ctx context.Context, name string) (*sqlx.NamedStmt, error) {
+	if stmt, ok := t.stmts[name]; ok {
+		return stmt, nil
+	}
+	entry, err := t.cache.acquire(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	t.entries = append(t.entries, entry)
+	stmt := t.tx.NamedStmtContext(ctx, entry.stmt)
+	t.stmts[name] = stmt
+	return stmt, nil
+}
+
+// queryError associates an execution error with the query, invalidating the pool statement if its cached plan is no longer valid.
+func (t *TxStmtCache) queryError(name string, err error) error {
+	if isCachedPlanError(err) {
+		t.cache.invalidate(name)
+	}
+	return &QueryError{Name: name, Err: err}
+}
+
+// isCachedPlanError reports whether err is the Postgres error raised when a prepared statement's result type changed since it was prepared.
+func isCachedPlanError(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "0A000" && strings.Contains(pqErr.Message, "cached plan must not change result type")
+}
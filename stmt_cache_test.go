@@ -0,0 +1,216 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// prepareDriver is a database driver whose connections only prepare statements, blocking the preparation of a query until it is released and counting the preparations of each query.
+type prepareDriver struct {
+	mu       sync.Mutex
+	blocked  map[string]chan struct{}
+	prepared map[string]int
+}
+
+type prepareConn struct {
+	driver *prepareDriver
+}
+
+type prepareStmt struct{}
+
+func (d *prepareDriver) Open(dsn string) (driver.Conn, error) {
+	return &prepareConn{driver: d}, nil
+}
+
+func (d *prepareDriver) count(query string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.prepared[query]
+}
+
+func (c *prepareConn) Prepare(query string) (driver.Stmt, error) {
+	c.driver.mu.Lock()
+	c.driver.prepared[query]++
+	blocked := c.driver.blocked[query]
+	c.driver.mu.Unlock()
+	if blocked != nil {
+		<-blocked
+	}
+	return prepareStmt{}, nil
+}
+
+func (c *prepareConn) Close() error {
+	return nil
+}
+
+func (c *prepareConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (prepareStmt) Close() error {
+	return nil
+}
+
+func (prepareStmt) NumInput() int {
+	return -1
+}
+
+func (prepareStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+func (prepareStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+var testPrepareDriver = &prepareDriver{blocked: map[string]chan struct{}{}, prepared: map[string]int{}}
+
+func init() {
+	sql.Register("dbxprepare", testPrepareDriver)
+}
+
+func TestStmtCache(t *testing.T) {
+	// given
+	db := setupTestDB(t, GenerateSchemaName("stmtcacheschema"))
+	queryMap := QueryMap{
+		"Insert": {Query: "INSERT INTO test (ColA) VALUES (:cola)"},
+		"Find":   {Query: "SELECT * FROM test WHERE ColA = :cola"},
+		"Count":  {Query: "SELECT count(*) FROM test"},
+	}
+	cache := NewStmtCache(db, queryMap, 2)
+	defer cache.Close()
+	ctx := context.Background()
+
+	// when
+	_, insertErr := cache.NamedExecContext(ctx, "Insert", map[string]interface{}{"cola": 200})
+	rows, findErr := cache.NamedQueryContext(ctx, "Find", map[string]interface{}{"cola": 200})
+	assert.NoError(t, findErr)
+	assert.True(t, rows.Next())
+	rows.Close()
+	countRows, countErr := cache.NamedQueryContext(ctx, "Count", nil)
+
+	// then
+	assert.NoError(t, insertErr)
+	require.NoError(t, countErr)
+	assert.NoError(t, countRows.Close())
+	assert.Equal(t, 2, cache.Len())
+
+	// when the result type of a cached plan changes
+	_, err := db.Exec("ALTER TABLE test ADD COLUMN ColB text")
+	assert.NoError(t, err)
+	rows, findErr = cache.NamedQueryContext(ctx, "Find", map[string]interface{}{"cola": 200})
+
+	// then the statement is prepared again
+	assert.NoError(t, findErr)
+	columns, err := rows.Columns()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cola", "colb"}, columns)
+	rows.Close()
+
+	// when
+	tx, err := db.Beginx()
+	assert.NoError(t, err)
+	txCache := cache.Tx(tx)
+	_, txInsertErr := txCache.NamedExecContext(ctx, "Insert", map[string]interface{}{"cola": 300})
+	_, txSecondInsertErr := txCache.NamedExecContext(ctx, "Insert", map[string]interface{}{"cola": 400})
+
+	// then
+	assert.NoError(t, txInsertErr)
+	assert.NoError(t, txSecondInsertErr)
+	assert.Len(t, txCache.stmts, 1)
+	assert.NoError(t, tx.Commit())
+	assert.NoError(t, txCache.Close())
+}
+
+func TestStmtCachePreparesOutsideLock(t *testing.T) {
+	// given
+	release := make(chan struct{})
+	testPrepareDriver.mu.Lock()
+	testPrepareDriver.blocked["SELECT 'slow'"] = release
+	testPrepareDriver.prepared = map[string]int{}
+	testPrepareDriver.mu.Unlock()
+	db, err := sqlx.Open("dbxprepare", "")
+	assert.NoError(t, err)
+	defer db.Close()
+	cache := NewStmtCache(db, QueryMap{"Slow": {Query: "SELECT 'slow'"}, "Fast": {Query: "SELECT 'fast'"}}, 0)
+	defer cache.Close()
+	var wg sync.WaitGroup
+	slowErrs := make([]error, 2)
+	for i := range slowErrs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, slowErrs[i] = cache.NamedExecContext(context.Background(), "Slow", nil)
+		}(i)
+	}
+
+	for testPrepareDriver.count("SELECT 'slow'") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// when
+	fastDone := make(chan error)
+	go func() {
+		_, err := cache.NamedExecContext(context.Background(), "Fast", nil)
+		fastDone <- err
+	}()
+
+	// then
+	select {
+	case err := <-fastDone:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		close(release)
+		t.Fatal("a query waited on the preparation of another query")
+	}
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 1, testPrepareDriver.count("SELECT 'slow'"))
+
+	// when
+	close(release)
+	wg.Wait()
+
+	// then
+	assert.NoError(t, slowErrs[0])
+	assert.NoError(t, slowErrs[1])
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestStmtCacheErrors(t *testing.T) {
+	// given
+	cache := NewStmtCache(nil, QueryMap{}, 0)
+
+	// when
+	_, missingErr := cache.NamedExecContext(context.Background(), "Missing", nil)
+	assert.NoError(t, cache.Close())
+	_, closedErr := cache.NamedQueryContext(context.Background(), "Missing", nil)
+
+	// then
+	assert.Equal(t, DefaultStmtCacheCapacity, cache.capacity)
+	assert.EqualError(t, missingErr, "Missing: query not found")
+	assert.True(t, errors.Is(missingErr, ErrQueryNotFound))
+	assert.True(t, errors.Is(closedErr, ErrStmtCacheClosed))
+}
@@ -0,0 +1,40 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+// setupTestDB initializes and migrates the named test schema, skipping the test when no database is reachable. The schema is dropped and the connection closed when the test completes.
+func setupTestDB(t *testing.T, schema string) *sqlx.DB {
+	t.Helper()
+	pgdsn := GetDsn()
+	conn, err := sqlx.Connect(PostgresType, pgdsn)
+	if err != nil {
+		t.Skipf("no database available: %v", err)
+	}
+	conn.Close()
+	db, err := InitializeTestDB(pgdsn, schema, "db/migrations")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+		TearDownTestDB(pgdsn, schema)
+	})
+	return db
+}
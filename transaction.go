@@ -0,0 +1,86 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrTxOptionsUnsupported is returned when transaction options are requested from a provider unable to honor them.
+var ErrTxOptionsUnsupported = errors.New("transaction options are not supported by the provider")
+
+// RunInTx begins a transaction using the provider and invokes fn with the transaction context. The transaction is committed if fn returns nil, and rolled back if fn returns an error, fn panics or the commit fails, in which case the panic is propagated once the transaction is rolled back. An error returned by the rollback is joined with the error returned by fn. opts may be nil to use the default isolation level and access mode. The transaction is begun with BeginTxContext when the provider is a TxContextProvider, and otherwise with GetTxContext, in which case ErrTxOptionsUnsupported is returned if opts requests anything other than the defaults.
+func RunInTx(ctx context.Context, provider DBContextProvider, opts *sql.TxOptions, fn func(DBTxContext) error) error {
+	return runInTx(func() (DBTxContext, error) { return beginTx(ctx, provider, opts) }, fn)
+}
+
+// RunInPgTx runs fn in a transaction as RunInTx does, beginning the transaction with GetPgTxContext so that it may be deferrable or import a snapshot.
+func RunInPgTx(ctx context.Context, provider PgTxContextProvider, opts PgTxOptions, fn func(DBTxContext) error) error {
+	return runInTx(func() (DBTxContext, error) { return provider.GetPgTxContext(ctx, opts) }, fn)
+}
+
+// runInTx begins a transaction using begin and invokes fn with the transaction context, as described by RunInTx.
+func runInTx(begin func() (DBTxContext, error), fn func(DBTxContext) error) error {
+	tx, err := begin()
+	if err != nil {
+		return err
+	}
+	done := false
+	defer func() {
+		if !done {
+			tx.Rollback()
+		}
+	}()
+	err = fn(tx)
+	done = true
+	if err != nil {
+		return rollback(tx, err)
+	}
+	if err := tx.Commit(); err != nil {
+		// a commit refused before ending the transaction, such as while a nested transaction is active, leaves it open
+		return rollback(tx, err)
+	}
+	return nil
+}
+
+// beginTx begins a transaction using opts, as described by RunInTx.
+func beginTx(ctx context.Context, provider DBContextProvider, opts *sql.TxOptions) (DBTxContext, error) {
+	if p, ok := provider.(TxContextProvider); ok {
+		return p.BeginTxContext(ctx, opts)
+	}
+	if opts != nil && *opts != (sql.TxOptions{}) {
+		return nil, ErrTxOptionsUnsupported
+	}
+	return provider.GetTxContext()
+}
+
+// beginPgTx begins a transaction using opts, returning ErrTxOptionsUnsupported if the provider is not a PgTxContextProvider.
+func beginPgTx(ctx context.Context, provider DBContextProvider, opts PgTxOptions) (DBTxContext, error) {
+	p, ok := provider.(PgTxContextProvider)
+	if !ok {
+		return nil, ErrTxOptionsUnsupported
+	}
+	return p.GetPgTxContext(ctx, opts)
+}
+
+// rollback rolls back the transaction after err, joining any error returned by the rollback, other than sql.ErrTxDone for a transaction that has already ended, with err.
+func rollback(tx DBTxContext, err error) error {
+	if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+		return errors.Join(err, rbErr)
+	}
+	return err
+}
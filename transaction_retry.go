@@ -0,0 +1,127 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// DefaultTxRetryMaxAttempts is the number of attempts made by RunInTxWithRetry when TxRetryOptions.MaxAttempts is not set.
+	DefaultTxRetryMaxAttempts = 5
+	// DefaultTxRetryInitialBackoff is the delay before the first retry when TxRetryOptions.InitialBackoff is not set.
+	DefaultTxRetryInitialBackoff = 10 * time.Millisecond
+	// DefaultTxRetryMaxBackoff is the longest delay between retries when TxRetryOptions.MaxBackoff is not set.
+	DefaultTxRetryMaxBackoff = time.Second
+	// DefaultTxRetryMultiplier is the factor the delay grows by after each retry when TxRetryOptions.Multiplier is not set.
+	DefaultTxRetryMultiplier = 2.0
+)
+
+// TxRetryOptions configures the retries made by RunInTxWithRetry. Zero valued fields take their defaults.
+type TxRetryOptions struct {
+	// TxOptions are used to begin every attempted transaction, and may be nil to use the default isolation level and access mode.
+	TxOptions *sql.TxOptions
+	// PgTxOptions, if set, are used in place of TxOptions to begin every attempted transaction with GetPgTxContext, such as to retry deferrable transactions. The provider must be a PgTxContextProvider, otherwise ErrTxOptionsUnsupported is returned.
+	PgTxOptions *PgTxOptions
+	// MaxAttempts limits the number of times the transaction is attempted, including the first attempt.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries.
+	MaxBackoff time.Duration
+	// Multiplier is the factor the delay grows by after each retry.
+	Multiplier float64
+	// OnRetry, if set, is called before waiting to retry a transaction that failed with a retryable error.
+	OnRetry func(TxRetryEvent)
+}
+
+// TxRetryEvent describes a failed attempt that is about to be retried.
+type TxRetryEvent struct {
+	// Attempt is the number of the failed attempt, starting at 1.
+	Attempt int
+	// Err is the retryable error returned by the failed attempt.
+	Err error
+	// Delay is the randomized time waited before the next attempt.
+	Delay time.Duration
+}
+
+// RunInTxWithRetry runs fn in a transaction as RunInTx does, running the whole of fn again in a new transaction whenever the transaction fails with a serialization failure or a deadlock, as reported by IsRetryableTxError. Retries are delayed using exponential backoff, with each delay randomized between half and all of its value, until the attempts are exhausted, in which case the last error is returned. fn must therefore be safe to run more than once. Cancelling the context stops any further retries, returning the context error joined with the last error.
+func RunInTxWithRetry(ctx context.Context, provider DBContextProvider, opts TxRetryOptions, fn func(DBTxContext) error) error {
+	opts = opts.withDefaults()
+	backoff := min(opts.InitialBackoff, opts.MaxBackoff)
+	begin := func() (DBTxContext, error) { return beginTx(ctx, provider, opts.TxOptions) }
+	if opts.PgTxOptions != nil {
+		begin = func() (DBTxContext, error) { return beginPgTx(ctx, provider, *opts.PgTxOptions) }
+	}
+	for attempt := 1; ; attempt++ {
+		err := runInTx(begin, fn)
+		if err == nil || !IsRetryableTxError(err) || attempt >= opts.MaxAttempts {
+			return err
+		}
+		delay := jitter(backoff)
+		if opts.OnRetry != nil {
+			opts.OnRetry(TxRetryEvent{Attempt: attempt, Err: err, Delay: delay})
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(ctx.Err(), err)
+		case <-timer.C:
+		}
+		backoff = min(time.Duration(float64(backoff)*opts.Multiplier), opts.MaxBackoff)
+	}
+}
+
+// IsRetryableTxError returns true if err is, or wraps, a Postgres serialization failure (40001) or deadlock (40P01), after which the transaction may succeed if run again.
+func IsRetryableTxError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
+
+// withDefaults returns the options, substituting the defaults for zero valued fields.
+func (o TxRetryOptions) withDefaults() TxRetryOptions {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = DefaultTxRetryMaxAttempts
+	}
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = DefaultTxRetryInitialBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = DefaultTxRetryMaxBackoff
+	}
+	if o.Multiplier <= 0 {
+		o.Multiplier = DefaultTxRetryMultiplier
+	}
+	return o
+}
+
+// jitter returns a random duration between half of d and d, so that transactions conflicting with one another do not retry in lockstep.
+func jitter(d time.Duration) time.Duration {
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
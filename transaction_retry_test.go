@@ -0,0 +1,120 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunInTxWithRetry(t *testing.T) {
+	// given
+	provider := &recordingProvider{context: &recordingContext{}}
+	var events []TxRetryEvent
+	opts := TxRetryOptions{
+		InitialBackoff: time.Microsecond,
+		MaxBackoff:     3 * time.Microsecond,
+		OnRetry:        func(e TxRetryEvent) { events = append(events, e) },
+	}
+	attempts := 0
+
+	// when
+	err := RunInTxWithRetry(context.Background(), provider, opts, func(tx DBTxContext) error {
+		attempts++
+		switch attempts {
+		case 1:
+			return &pq.Error{Code: "40001"}
+		case 2, 3:
+			return &QueryError{Name: "Write", Err: &pq.Error{Code: "40P01"}}
+		}
+		return nil
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, 4, attempts)
+	assert.True(t, provider.context.committed)
+	assert.Len(t, events, 3)
+	for i, bound := range []time.Duration{time.Microsecond, 2 * time.Microsecond, 3 * time.Microsecond} {
+		assert.Equal(t, i+1, events[i].Attempt)
+		assert.True(t, IsRetryableTxError(events[i].Err))
+		assert.True(t, events[i].Delay >= bound/2 && events[i].Delay <= bound, events[i].Delay)
+	}
+}
+
+func TestRunInTxWithRetryStops(t *testing.T) {
+	// given
+	provider := &recordingProvider{context: &recordingContext{}}
+	retryable := &pq.Error{Code: "40001"}
+	other := errors.New("failed")
+	opts := TxRetryOptions{MaxAttempts: 3, InitialBackoff: time.Microsecond}
+	exhaustedAttempts, otherAttempts, cancelledAttempts := 0, 0, 0
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// when
+	exhaustedErr := RunInTxWithRetry(context.Background(), provider, opts, func(tx DBTxContext) error {
+		exhaustedAttempts++
+		return retryable
+	})
+	otherErr := RunInTxWithRetry(context.Background(), provider, opts, func(tx DBTxContext) error {
+		otherAttempts++
+		return other
+	})
+	opts.InitialBackoff, opts.MaxBackoff = time.Hour, time.Hour
+	opts.OnRetry = func(TxRetryEvent) { cancel() }
+	cancelledErr := RunInTxWithRetry(ctx, provider, opts, func(tx DBTxContext) error {
+		cancelledAttempts++
+		return retryable
+	})
+
+	// then
+	assert.Equal(t, retryable, exhaustedErr)
+	assert.Equal(t, 3, exhaustedAttempts)
+	assert.Equal(t, other, otherErr)
+	assert.Equal(t, 1, otherAttempts)
+	assert.True(t, errors.Is(cancelledErr, context.Canceled))
+	assert.True(t, errors.Is(cancelledErr, retryable))
+	assert.Equal(t, 1, cancelledAttempts)
+}
+
+func TestRunInTxWithRetryPgTxOptions(t *testing.T) {
+	// given
+	provider := &pgTxProvider{recordingProvider: &recordingProvider{context: &recordingContext{}}}
+	opts := TxRetryOptions{PgTxOptions: &PgTxOptions{Snapshot: "00000003-0000001B-1"}, InitialBackoff: time.Microsecond}
+	attempts := 0
+
+	// when
+	err := RunInTxWithRetry(context.Background(), provider, opts, func(tx DBTxContext) error {
+		attempts++
+		if attempts == 1 {
+			return &pq.Error{Code: "40001"}
+		}
+		return nil
+	})
+	unsupportedErr := RunInTxWithRetry(context.Background(), &recordingProvider{context: &recordingContext{}}, opts, func(tx DBTxContext) error {
+		return nil
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []PgTxOptions{*opts.PgTxOptions, *opts.PgTxOptions}, provider.pgTxOptions)
+	assert.False(t, provider.txStarted)
+	assert.Equal(t, ErrTxOptionsUnsupported, unsupportedErr)
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 Daniel Akiva
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunInTxCommits(t *testing.T) {
+	// given
+	provider := &recordingProvider{context: &recordingContext{}}
+	opts := &sql.TxOptions{Isolation: sql.LevelSerializable}
+
+	// when
+	err := RunInTx(context.Background(), provider, opts, func(tx DBTxContext) error {
+		_, err := tx.NamedExec("UPDATE test SET ColA = 1", nil)
+		return err
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, opts, provider.txOptions)
+	assert.Equal(t, []string{"UPDATE test SET ColA = 1"}, provider.context.statements)
+	assert.True(t, provider.context.committed)
+	assert.False(t, provider.context.rolledBack)
+}
+
+func TestRunInTxRollsBackOnError(t *testing.T) {
+	// given
+	fnErr := errors.New("failed")
+	rbErr := errors.New("rollback failed")
+	provider := &recordingProvider{context: &recordingContext{}}
+	failingProvider := &recordingProvider{context: &recordingContext{rbErr: rbErr}}
+	doneProvider := &recordingProvider{context: &recordingContext{rbErr: sql.ErrTxDone}}
+	fn := func(tx DBTxContext) error { return fnErr }
+
+	// when
+	err := RunInTx(context.Background(), provider, nil, fn)
+	joinedErr := RunInTx(context.Background(), failingProvider, nil, fn)
+	doneErr := RunInTx(context.Background(), doneProvider, nil, fn)
+
+	// then
+	assert.Equal(t, fnErr, err)
+	assert.True(t, provider.context.rolledBack)
+	assert.False(t, provider.context.committed)
+	assert.True(t, errors.Is(joinedErr, fnErr))
+	assert.True(t, errors.Is(joinedErr, rbErr))
+	assert.Equal(t, fnErr, doneErr)
+}
+
+func TestRunInTxRollsBackOnPanic(t *testing.T) {
+	// given
+	provider := &recordingProvider{context: &recordingContext{}}
+
+	// when
+	recovered := func() (p interface{}) {
+		defer func() { p = recover() }()
+		RunInTx(context.Background(), provider, nil, func(tx DBTxContext) error {
+			panic("failed")
+		})
+		return nil
+	}()
+
+	// then
+	assert.Equal(t, "failed", recovered)
+	assert.True(t, provider.context.rolledBack)
+	assert.False(t, provider.context.committed)
+}
+
+func TestRunInTxReturnsCommitError(t *testing.T) {
+	// given
+	commitErr := errors.New("commit failed")
+	provider := &recordingProvider{context: &recordingContext{commitErr: commitErr}}
+
+	// when
+	err := RunInTx(context.Background(), provider, nil, func(tx DBTxContext) error { return nil })
+
+	// then
+	assert.Equal(t, commitErr, err)
+	assert.True(t, provider.context.rolledBack)
+}
+
+func TestRunInTxRollsBackOnRefusedCommit(t *testing.T) {
+	// given
+	rbErr := errors.New("rollback failed")
+	provider := &recordingProvider{context: &recordingContext{commitErr: ErrActiveSavepoint, rbErr: rbErr}}
+
+	// when
+	err := RunInTx(context.Background(), provider, nil, func(tx DBTxContext) error { return nil })
+
+	// then
+	assert.True(t, provider.context.rolledBack)
+	assert.True(t, errors.Is(err, ErrActiveSavepoint))
+	assert.True(t, errors.Is(err, rbErr))
+}
+
+// txContextProvider implements only DBContextProvider, beginning transactions without options.
+type txContextProvider struct {
+	context *recordingContext
+}
+
+func (p *txContextProvider) GetTxContext() (DBTxContext, error) {
+	return p.context, nil
+}
+
+func (p *txContextProvider) GetContext() (DBContext, error) {
+	return p.context, nil
+}
+
+func TestRunInTxWithoutTxOptions(t *testing.T) {
+	// given
+	provider := &txContextProvider{context: &recordingContext{}}
+	fn := func(tx DBTxContext) error { return nil }
+
+	// when
+	err := RunInTx(context.Background(), provider, nil, fn)
+	defaultErr := RunInTx(context.Background(), provider, &sql.TxOptions{}, fn)
+	serializableErr := RunInTx(context.Background(), provider, &sql.TxOptions{Isolation: sql.LevelSerializable}, fn)
+
+	// then
+	assert.NoError(t, err)
+	assert.NoError(t, defaultErr)
+	assert.True(t, provider.context.committed)
+	assert.Equal(t, ErrTxOptionsUnsupported, serializableErr)
+}
+
+// pgTxProvider records the Postgres options of the transactions it begins.
+type pgTxProvider struct {
+	*recordingProvider
+	pgTxOptions []PgTxOptions
+}
+
+func (p *pgTxProvider) GetPgTxContext(ctx context.Context, opts PgTxOptions) (DBTxContext, error) {
+	p.pgTxOptions = append(p.pgTxOptions, opts)
+	return p.context, nil
+}
+
+func TestRunInPgTx(t *testing.T) {
+	// given
+	provider := &pgTxProvider{recordingProvider: &recordingProvider{context: &recordingContext{}}}
+	opts := PgTxOptions{TxOptions: &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true}, Deferrable: true}
+
+	// when
+	err := RunInPgTx(context.Background(), provider, opts, func(tx DBTxContext) error {
+		_, err := tx.NamedExec("SELECT 1", nil)
+		return err
+	})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []PgTxOptions{opts}, provider.pgTxOptions)
+	assert.False(t, provider.txStarted)
+	assert.True(t, provider.context.committed)
+}